@@ -0,0 +1,17 @@
+package client
+
+import "time"
+
+// Clock is the source of the current time used by a Conn to decide when to ping the server and when a ping
+// times out. Ticks are still driven by real time every TickInterval, so a Clock advanced manually takes effect
+// on the next tick.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the Clock used if Dialer.Clock is nil.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,372 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+)
+
+const (
+	PingInterval = 30 * time.Second
+	PingTimeout  = 5 * time.Second
+	TickInterval = 50 * time.Millisecond
+
+	// HandshakeTimeout is the duration Dial waits for the ServerHandshake.
+	HandshakeTimeout = 10 * time.Second
+	// DefaultWriteTimeout is the write timeout used if Dialer.WriteTimeout is zero.
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// ErrHandshakeFailed is returned by Dial when the server denied the handshake.
+var ErrHandshakeFailed = errors.New("handshake denied by server")
+
+// Conn represents the connection to a StarGate server.
+//
+// A Conn is never redialed. When the server asks the client to reconnect, the Conn is closed just like on
+// Disconnect, and the caller must dial again with the same client name within server.ReconnectTimeout
+// to take over its old name:
+//
+//	<-c.Closed()
+//	if _, ok := c.ReconnectRequested(); ok {
+//		c, err = client.Dial(addr, data)
+//	}
+type Conn struct {
+	net.Conn
+
+	// Name is the client name used in the handshake.
+	Name string
+
+	mu sync.Mutex
+	// queuedPackets contains the packets queued in.
+	// This will be sent to the connection on next available tick.
+	queuedPackets []*protocol.Wrapper
+	// reconnectReason is the reason of the Reconnect sent by the server, if reconnect is true.
+	reconnectReason string
+	reconnect       bool
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	// closing is set by the first call to DisconnectAndClose or closeConn, so that only one Disconnect is sent.
+	closing atomic.Bool
+
+	logger *slog.Logger
+	clock  Clock
+
+	lastPingTime time.Time
+	lastPongTime time.Time
+	pingPending  bool
+
+	h Handler
+
+	// writeMu serializes the writes of enc.
+	writeMu sync.Mutex
+	// writeTimeout is the max duration of a flush.
+	writeTimeout time.Duration
+	enc          *protocol.Encoder
+	dec          *protocol.Decoder
+}
+
+// Dialer holds the settings used to dial a StarGate server.
+type Dialer struct {
+	// TLSConfig, if not nil, dials the server over TLS. Set Certificates to present a client certificate.
+	TLSConfig *tls.Config
+	// Registry is the set of packets decoded by the connection. If nil, protocol.DefaultRegistry is used.
+	Registry *protocol.Registry
+	// Clock is the source of the current time of the connection. If nil, the system clock is used.
+	Clock Clock
+	// WriteTimeout is the max duration of a write to the server, after which the connection is closed,
+	// so that a server that stopped reading cannot block Close. If zero, DefaultWriteTimeout is used.
+	WriteTimeout time.Duration
+}
+
+// Dial dials the StarGate server on specified addr and performs the handshake with given data.
+func Dial(addr string, data types.HandshakeData) (*Conn, error) {
+	return Dialer{}.Dial(addr, data)
+}
+
+// DialTLS dials the StarGate server on specified addr over TLS and performs the handshake with given data.
+// Set Certificates of the config to present a client certificate.
+func DialTLS(addr string, data types.HandshakeData, conf *tls.Config) (*Conn, error) {
+	return Dialer{TLSConfig: conf}.Dial(addr, data)
+}
+
+// Dial dials the StarGate server on specified addr using the Dialer and performs the handshake with given data.
+func (d Dialer) Dial(addr string, data types.HandshakeData) (*Conn, error) {
+	var netConn net.Conn
+	var err error
+	if d.TLSConfig != nil {
+		netConn, err = tls.Dial("tcp", addr, d.TLSConfig)
+	} else {
+		netConn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	registry := d.Registry
+	clock := d.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	writeTimeout := d.WriteTimeout
+	if writeTimeout == 0 {
+		writeTimeout = DefaultWriteTimeout
+	}
+	c := &Conn{
+		Conn: netConn,
+		Name: data.ClientName,
+
+		queuedPackets: make([]*protocol.Wrapper, 0),
+		closed:        make(chan struct{}),
+
+		logger: slog.Default().With("addr", addr, "conn", data.ClientName),
+		clock:  clock,
+
+		lastPongTime: clock.Now(),
+
+		writeTimeout: writeTimeout,
+		enc:          protocol.NewEncoder(netConn),
+		dec:          protocol.NewDecoder(netConn, registry),
+	}
+	if err := c.handshake(data); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	c.logger.Info("connected to server")
+
+	go c.tick()
+	return c, nil
+}
+
+// handshake sends the Handshake and waits for the ServerHandshake.
+// If data.Protocol supports challenge-response authentication, the password is proved in AuthResponse instead.
+func (c *Conn) handshake(data types.HandshakeData) error {
+	secret := data.Password
+	challenge := data.Protocol >= types.ProtocolChallengeAuth
+	if challenge {
+		data.Password = ""
+	}
+	_ = c.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer c.SetDeadline(time.Time{})
+
+	if err := c.enc.Encode(&protocol.Wrapper{P: &protocol.Handshake{Data: data}}); err != nil {
+		return err
+	}
+
+	for {
+		w, err := c.ReadPacket()
+		if err != nil {
+			return fmt.Errorf("failed to read server handshake: %w", err)
+		}
+		switch pk := w.P.(type) {
+		case *protocol.ServerHandshake:
+			if !pk.Success {
+				return ErrHandshakeFailed
+			}
+			return nil
+		case *protocol.AuthChallenge:
+			if !challenge {
+				return fmt.Errorf("unexpected auth challenge")
+			}
+			resp := &protocol.AuthResponse{Proof: protocol.ChallengeProof(secret, pk.Nonce, data.ClientName)}
+			if err := c.enc.Encode(&protocol.Wrapper{P: resp}); err != nil {
+				return err
+			}
+		case *protocol.Disconnect:
+			return fmt.Errorf("disconnected during handshake: %s", pk.Reason)
+		default:
+			c.logger.Warn("unexpected packet during handshake", "packetID", w.P.ID(), "expected", protocol.IDServerHandshake)
+		}
+	}
+}
+
+// QueuePacket queues the packet to be sent on next tick.
+func (c *Conn) QueuePacket(w *protocol.Wrapper) {
+	c.mu.Lock()
+	c.queuedPackets = append(c.queuedPackets, w)
+	c.mu.Unlock()
+}
+
+// Handler sets packet handler for this connection.
+func (c *Conn) Handler(h Handler) {
+	c.mu.Lock()
+	c.h = h
+	c.mu.Unlock()
+}
+
+// ReadPacket reads a single packet from the connection.
+func (c *Conn) ReadPacket() (*protocol.Wrapper, error) {
+	return c.dec.Decode()
+}
+
+func (c *Conn) tick() {
+	ticker := time.NewTicker(TickInterval)
+	defer ticker.Stop()
+
+	readChan := make(chan *protocol.Wrapper)
+	errChan := make(chan error, 1)
+
+	go c.readLoop(readChan, errChan)
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if !c.onTick() {
+				c.logger.Warn("ping timeout, closing connection")
+				c.DisconnectAndClose("Ping timeout")
+				return
+			}
+		case wrapper := <-readChan:
+			c.handlePacket(wrapper)
+		case err := <-errChan:
+			if errors.Is(err, io.EOF) {
+				c.logger.Info("connection closed")
+			} else {
+				c.logger.Warn("failed to read packet", "err", err)
+			}
+			c.closeConn()
+			return
+		}
+	}
+}
+
+func (c *Conn) readLoop(readChan chan *protocol.Wrapper, errChan chan error) {
+	for {
+		w, err := c.ReadPacket()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		select {
+		case readChan <- w:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// onTick flushes the queued packets and sends a ping if needed.
+// It returns false if the server did not answer the last ping in time.
+func (c *Conn) onTick() bool {
+	c.flush()
+
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pingPending {
+		return now.Sub(c.lastPingTime) < PingTimeout
+	}
+	if now.Sub(c.lastPongTime) >= PingInterval {
+		c.lastPingTime = now
+		c.pingPending = true
+		c.queuedPackets = append(c.queuedPackets, &protocol.Wrapper{
+			P: &protocol.Ping{PingTime: now.UnixMilli()},
+		})
+	}
+	return true
+}
+
+// flush writes all queued packets to the connection with a single write, failing after the write timeout.
+func (c *Conn) flush() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	queued := c.queuedPackets
+	c.queuedPackets = make([]*protocol.Wrapper, 0)
+	c.mu.Unlock()
+	if len(queued) == 0 {
+		return
+	}
+	// The write deadline uses the system clock, as it is applied by the connection.
+	_ = c.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if err := c.enc.Encode(queued...); err != nil {
+		c.logger.Error("failed to write packet", "err", err)
+		c.closeConn()
+	}
+}
+
+func (c *Conn) handlePacket(wrapper *protocol.Wrapper) {
+	c.mu.Lock()
+	h := c.h
+	c.mu.Unlock()
+	if h != nil {
+		if err := h.Handle(wrapper); err != nil {
+			c.logger.Error("failed to handle packet", "err", err)
+		}
+	}
+
+	switch pk := wrapper.P.(type) {
+	case *protocol.Disconnect:
+		c.logger.Info("disconnected by server", "reason", pk.Reason)
+		c.closeConn()
+	case *protocol.Reconnect:
+		c.logger.Info("server asked to reconnect", "reason", pk.Reason)
+		c.mu.Lock()
+		c.reconnectReason, c.reconnect = pk.Reason, true
+		c.mu.Unlock()
+		c.closeConn()
+	case *protocol.Ping:
+		c.QueuePacket(&protocol.Wrapper{
+			P: &protocol.Pong{PingTime: pk.PingTime},
+		})
+	case *protocol.Pong:
+		c.mu.Lock()
+		c.pingPending = false
+		c.lastPongTime = c.clock.Now()
+		c.mu.Unlock()
+	}
+}
+
+// Closed returns a channel that is closed when the connection is closed.
+func (c *Conn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// ReconnectRequested reports whether the connection was closed because the server asked the client to reconnect,
+// and the reason it gave. The caller is expected to dial the server again once Closed is closed.
+func (c *Conn) ReconnectRequested() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reconnectReason, c.reconnect
+}
+
+// DisconnectAndClose sends a disconnect packet with the given reason and closes the connection.
+func (c *Conn) DisconnectAndClose(reason string) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return
+	}
+
+	c.logger.Info("disconnecting", "reason", reason)
+	c.QueuePacket(&protocol.Wrapper{
+		P: &protocol.Disconnect{Reason: reason},
+	})
+	c.flush()
+	c.closeConn()
+}
+
+// Close disconnects from the server with protocol.ReasonClientShutdown.
+func (c *Conn) Close() error {
+	c.DisconnectAndClose(protocol.ReasonClientShutdown)
+	return nil
+}
+
+func (c *Conn) closeConn() {
+	c.closeOnce.Do(func() {
+		c.closing.Store(true)
+		close(c.closed)
+		c.logger.Info("closing connection")
+		_ = c.Conn.Close()
+	})
+}
@@ -0,0 +1,207 @@
+package client_test
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/client"
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+	"github.com/alvin0319/go-stargate-server/server"
+	"github.com/alvin0319/go-stargate-server/servertest"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetLogLoggerLevel(slog.LevelError)
+	os.Exit(m.Run())
+}
+
+func TestRedialAfterReconnect(t *testing.T) {
+	l, err := server.ListenConfig{Authenticator: server.PasswordAuthenticator{Password: "secret"}}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Close)
+	addr := l.Addr().String()
+	data := types.HandshakeData{ClientName: "lobby", Password: "secret"}
+
+	c, err := client.Dial(addr, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.ReconnectRequested(); ok {
+		t.Error("reconnect requested before the server asked")
+	}
+	l.Accept().Reconnect("update")
+
+	select {
+	case <-c.Closed():
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not closed after Reconnect")
+	}
+	if reason, ok := c.ReconnectRequested(); !ok || reason != "update" {
+		t.Fatalf("got reconnect %v with reason %q, want reason update", ok, reason)
+	}
+
+	redialed, err := client.Dial(addr, data)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer redialed.Close()
+	if conn := l.Accept(); conn.Name != "lobby" {
+		t.Errorf("redialed client is named %q, want lobby", conn.Name)
+	}
+}
+
+func TestHandshakeDenied(t *testing.T) {
+	l, err := server.ListenConfig{Authenticator: server.PasswordAuthenticator{Password: "secret"}}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Close)
+	go l.Accept()
+
+	c, err := client.Dial(l.Addr().String(), types.HandshakeData{ClientName: "lobby", Password: "wrong"})
+	if !errors.Is(err, client.ErrHandshakeFailed) {
+		t.Fatalf("got %v, want ErrHandshakeFailed", err)
+	}
+	if c != nil {
+		t.Error("got a connection for a denied handshake")
+	}
+}
+
+// dialScripted dials a scripted server accepting the handshake, and returns the client and the server side
+// of the connection, which does not read anything after the handshake.
+func dialScripted(t *testing.T, d client.Dialer) (*client.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		defer close(accepted)
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// The client sends nothing after the Handshake until the ServerHandshake, so the decoder does not
+		// buffer anything past it.
+		if _, err := protocol.NewDecoder(conn, nil).Decode(); err != nil {
+			t.Error(err)
+		}
+		if err := protocol.NewEncoder(conn).Encode(&protocol.Wrapper{P: &protocol.ServerHandshake{Success: true}}); err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	c, err := d.Dial(ln.Addr().String(), types.HandshakeData{ClientName: "lobby", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return c, conn
+}
+
+func TestKeepalive(t *testing.T) {
+	clock := servertest.NewClock(time.Unix(0, 0))
+	c, conn := dialScripted(t, client.Dialer{Clock: clock})
+	srv := servertest.NewClient(conn, nil)
+
+	// The client answers the pings of the server.
+	if err := srv.Send(&protocol.Ping{PingTime: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if pong, err := servertest.Expect[protocol.Pong](srv, servertest.DefaultTimeout); err != nil || pong.PingTime != 42 {
+		t.Fatalf("got %+v, %v, want pong 42", pong, err)
+	}
+
+	// The client pings the server every PingInterval, and an answered ping does not time out.
+	for i := 0; i < 2; i++ {
+		clock.Advance(client.PingInterval)
+		ping, err := servertest.Expect[protocol.Ping](srv, servertest.DefaultTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ping.PingTime != clock.Now().UnixMilli() {
+			t.Errorf("got ping time %d, want %d", ping.PingTime, clock.Now().UnixMilli())
+		}
+		if err := srv.Send(&protocol.Pong{PingTime: ping.PingTime}); err != nil {
+			t.Fatal(err)
+		}
+		// The Pong was handled once the Ping sent after it is answered.
+		if err := srv.Sync(servertest.DefaultTimeout); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(client.PingTimeout)
+		time.Sleep(2 * client.TickInterval)
+		if err := srv.Sync(servertest.DefaultTimeout); err != nil {
+			t.Fatalf("answered ping timed out: %v", err)
+		}
+	}
+
+	// An unanswered ping times out, and a concurrent Close does not send a second Disconnect.
+	clock.Advance(client.PingInterval)
+	if _, err := servertest.Expect[protocol.Ping](srv, servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		clock.Advance(client.PingTimeout)
+		time.Sleep(client.TickInterval)
+		_ = c.Close()
+	}()
+	received, err := srv.Closed(servertest.DefaultTimeout)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("got %d packets, want a single Disconnect: %v", len(received), received)
+	}
+	if pk, ok := received[0].P.(*protocol.Disconnect); !ok {
+		t.Errorf("got %T, want Disconnect", received[0].P)
+	} else if pk.Reason != "Ping timeout" && pk.Reason != protocol.ReasonClientShutdown {
+		t.Errorf("got reason %q", pk.Reason)
+	}
+	select {
+	case <-c.Closed():
+	case <-time.After(servertest.DefaultTimeout):
+		t.Error("connection was not closed")
+	}
+}
+
+func TestCloseWriteTimeout(t *testing.T) {
+	c, _ := dialScripted(t, client.Dialer{WriteTimeout: 100 * time.Millisecond})
+
+	// The server side never reads, so the queued packets fill the socket buffers.
+	payload := make([]byte, protocol.MaxPayloadLength-64)
+	payload[0] = protocol.IDServerTransfer
+	for i := 0; i < 64; i++ {
+		c.QueuePacket(&protocol.Wrapper{P: &protocol.Forward{ClientName: "game", Payload: payload}})
+	}
+	closed := make(chan struct{})
+	go func() {
+		_ = c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(servertest.DefaultTimeout):
+		t.Fatal("Close blocked on a server that does not read")
+	}
+}
@@ -0,0 +1,17 @@
+package client
+
+import "github.com/alvin0319/go-stargate-server/protocol"
+
+// Handler has the same method set as server.Handler, so the same handler can be used on both sides.
+type Handler interface {
+	// Handle handles the wrapper packet.
+	Handle(w *protocol.Wrapper) error
+}
+
+type DefaultHandler struct {
+	Handler
+}
+
+func (h DefaultHandler) Handle(w *protocol.Wrapper) error {
+	return nil
+}
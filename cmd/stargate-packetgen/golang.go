@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// protocolImport is the import path of the protocol package, which the registration file refers to.
+const protocolImport = "github.com/alvin0319/go-stargate-server/protocol"
+
+// goPacket returns the Go source of the packet, written in the style of the built-in packets.
+func goPacket(s *Schema, p Packet, source string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by stargate-packetgen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", s.Package)
+	if len(p.Fields) == 0 {
+		b.WriteString("import \"io\"\n\n")
+	} else {
+		b.WriteString("import (\n\t\"io\"\n\n\t\"github.com/alvin0319/go-stargate-server/util\"\n)\n\n")
+	}
+
+	writeDoc(&b, "", p.Doc, fmt.Sprintf("%s is a packet generated from %s.", p.Name, source))
+	if len(p.Fields) == 0 {
+		fmt.Fprintf(&b, "type %s struct{}\n\n", p.Name)
+	} else {
+		fmt.Fprintf(&b, "type %s struct {\n", p.Name)
+		for _, f := range p.Fields {
+			if f.Doc != "" {
+				writeDoc(&b, "\t", f.Doc, "")
+			}
+			fmt.Fprintf(&b, "\t%s %s\n", f.Name, fieldTypes[f.Type].goType)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	if len(p.Fields) == 0 {
+		fmt.Fprintf(&b, "func (*%s) Read(io.Reader) error {\n\treturn nil\n}\n\n", p.Name)
+		fmt.Fprintf(&b, "func (*%s) Write(io.Writer) error {\n\treturn nil\n}\n\n", p.Name)
+	} else {
+		fmt.Fprintf(&b, "func (p *%s) Read(r io.Reader) error {\n\tvar err error\n\n", p.Name)
+		for _, f := range p.Fields {
+			fmt.Fprintf(&b, "\tp.%s, err = util.Read%s(r)\n\tif err != nil {\n\t\treturn err\n\t}\n\n", f.Name, fieldTypes[f.Type].util)
+		}
+		b.WriteString("\treturn nil\n}\n\n")
+
+		fmt.Fprintf(&b, "func (p *%s) Write(w io.Writer) error {\n", p.Name)
+		last := len(p.Fields) - 1
+		for _, f := range p.Fields[:last] {
+			fmt.Fprintf(&b, "\tif err := util.Write%s(w, p.%s); err != nil {\n\t\treturn err\n\t}\n\n", fieldTypes[f.Type].util, f.Name)
+		}
+		fmt.Fprintf(&b, "\treturn util.Write%s(w, p.%s)\n}\n\n", fieldTypes[p.Fields[last].Type].util, p.Fields[last].Name)
+	}
+
+	fmt.Fprintf(&b, "func (*%s) ID() uint64 {\n\treturn ID%s\n}\n", p.Name, p.Name)
+	return format.Source(b.Bytes())
+}
+
+// goRegistry returns the Go source declaring the packet IDs and RegisterPackets.
+func goRegistry(s *Schema, source string) ([]byte, error) {
+	// The generated packets may be placed in the protocol package itself.
+	qualifier := "protocol."
+	if s.Package == "protocol" {
+		qualifier = ""
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by stargate-packetgen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", s.Package)
+	if qualifier != "" && len(s.Packets) != 0 {
+		fmt.Fprintf(&b, "import %q\n\n", protocolImport)
+	}
+
+	if len(s.Packets) != 0 {
+		b.WriteString("const (\n")
+		for _, p := range s.Packets {
+			fmt.Fprintf(&b, "\tID%s = 0x%02x\n", p.Name, p.ID)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	fmt.Fprintf(&b, "// RegisterPackets registers the packets generated from %s to the Registry.\n", source)
+	fmt.Fprintf(&b, "func RegisterPackets(r *%sRegistry) error {\n", qualifier)
+	for _, p := range s.Packets {
+		fmt.Fprintf(&b, "\tif err := r.Register(ID%s, func() %sPacket { return &%s{} }); err != nil {\n\t\treturn err\n\t}\n", p.Name, qualifier, p.Name)
+	}
+	b.WriteString("\treturn nil\n}\n")
+	return format.Source(b.Bytes())
+}
+
+// writeDoc writes the doc as line comments with the indent, or def if the doc is empty.
+func writeDoc(b *bytes.Buffer, indent, doc, def string) {
+	if doc == "" {
+		doc = def
+	}
+	for _, line := range strings.Split(strings.TrimSpace(doc), "\n") {
+		fmt.Fprintf(b, "%s// %s\n", indent, strings.TrimSpace(line))
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultJavaBaseClass is the class the generated Java packets extend if JavaBaseClass is not set in the schema.
+const defaultJavaBaseClass = "alemiz.stargate.protocol.StarGatePacket"
+
+// javaCodec is the ByteBuf encoding of a field type in Java.
+type javaCodec struct {
+	// write and read are format strings of the statement and expression, given the field name.
+	write, read string
+	// helper is the name of the helper in javaHelpers the codec needs, if any.
+	helper string
+}
+
+// javaCodecs maps the types allowed in the schema to their ByteBuf encodings, matching the util package.
+var javaCodecs = map[string]javaCodec{
+	"bool":     {write: "byteBuf.writeBoolean(this.%s);", read: "byteBuf.readBoolean()"},
+	"byte":     {write: "byteBuf.writeByte(this.%s);", read: "byteBuf.readByte()"},
+	"int16":    {write: "byteBuf.writeShort(this.%s);", read: "byteBuf.readShort()"},
+	"uint16":   {write: "byteBuf.writeShort(this.%s);", read: "byteBuf.readUnsignedShort()"},
+	"int32":    {write: "byteBuf.writeInt(this.%s);", read: "byteBuf.readInt()"},
+	"uint32":   {write: "byteBuf.writeInt((int) this.%s);", read: "byteBuf.readUnsignedInt()"},
+	"int64":    {write: "byteBuf.writeLong(this.%s);", read: "byteBuf.readLong()"},
+	"uint64":   {write: "byteBuf.writeLong(this.%s);", read: "byteBuf.readLong()"},
+	"float32":  {write: "byteBuf.writeFloat(this.%s);", read: "byteBuf.readFloat()"},
+	"float64":  {write: "byteBuf.writeDouble(this.%s);", read: "byteBuf.readDouble()"},
+	"string":   {write: "writeString(byteBuf, this.%s);", read: "readString(byteBuf)", helper: "String"},
+	"bytes":    {write: "writeBytes(byteBuf, this.%s);", read: "readBytes(byteBuf)", helper: "Bytes"},
+	"[]string": {write: "writeStringArray(byteBuf, this.%s);", read: "readStringArray(byteBuf)", helper: "StringArray"},
+	"[]int32":  {write: "writeIntArray(byteBuf, this.%s);", read: "readIntArray(byteBuf)", helper: "IntArray"},
+	"[]int64":  {write: "writeLongArray(byteBuf, this.%s);", read: "readLongArray(byteBuf)", helper: "LongArray"},
+}
+
+// javaHelpers contains the static methods encoding the length-prefixed types, written like util.
+// A null value is written as an empty one, like a nil slice in Go.
+var javaHelpers = map[string]string{
+	"String": `    private static void writeString(ByteBuf byteBuf, String value) {
+        byte[] bytes = value == null ? new byte[0] : value.getBytes(StandardCharsets.UTF_8);
+        byteBuf.writeInt(bytes.length);
+        byteBuf.writeBytes(bytes);
+    }
+
+    private static String readString(ByteBuf byteBuf) {
+        int length = byteBuf.readInt();
+        return byteBuf.readCharSequence(length, StandardCharsets.UTF_8).toString();
+    }
+`,
+	"Bytes": `    private static void writeBytes(ByteBuf byteBuf, byte[] value) {
+        if (value == null) {
+            value = new byte[0];
+        }
+        byteBuf.writeInt(value.length);
+        byteBuf.writeBytes(value);
+    }
+
+    private static byte[] readBytes(ByteBuf byteBuf) {
+        byte[] value = new byte[byteBuf.readInt()];
+        byteBuf.readBytes(value);
+        return value;
+    }
+`,
+	"StringArray": `    private static void writeStringArray(ByteBuf byteBuf, String[] value) {
+        if (value == null) {
+            value = new String[0];
+        }
+        byteBuf.writeInt(value.length);
+        for (String s : value) {
+            byte[] bytes = s.getBytes(StandardCharsets.UTF_8);
+            byteBuf.writeInt(bytes.length);
+            byteBuf.writeBytes(bytes);
+        }
+    }
+
+    private static String[] readStringArray(ByteBuf byteBuf) {
+        String[] value = new String[byteBuf.readInt()];
+        for (int i = 0; i < value.length; i++) {
+            int length = byteBuf.readInt();
+            value[i] = byteBuf.readCharSequence(length, StandardCharsets.UTF_8).toString();
+        }
+        return value;
+    }
+`,
+	"IntArray": `    private static void writeIntArray(ByteBuf byteBuf, int[] value) {
+        if (value == null) {
+            value = new int[0];
+        }
+        byteBuf.writeInt(value.length);
+        for (int v : value) {
+            byteBuf.writeInt(v);
+        }
+    }
+
+    private static int[] readIntArray(ByteBuf byteBuf) {
+        int[] value = new int[byteBuf.readInt()];
+        for (int i = 0; i < value.length; i++) {
+            value[i] = byteBuf.readInt();
+        }
+        return value;
+    }
+`,
+	"LongArray": `    private static void writeLongArray(ByteBuf byteBuf, long[] value) {
+        if (value == null) {
+            value = new long[0];
+        }
+        byteBuf.writeInt(value.length);
+        for (long v : value) {
+            byteBuf.writeLong(v);
+        }
+    }
+
+    private static long[] readLongArray(ByteBuf byteBuf) {
+        long[] value = new long[byteBuf.readInt()];
+        for (int i = 0; i < value.length; i++) {
+            value[i] = byteBuf.readLong();
+        }
+        return value;
+    }
+`,
+}
+
+// javaClassName returns the name of the Java class of the packet.
+func javaClassName(p Packet) string {
+	return p.Name + "Packet"
+}
+
+// javaPacket returns the Java source of the packet class for the StarGate plugin. The class is not compiled
+// here, see the experimental note of the command documentation.
+func javaPacket(s *Schema, p Packet, source string) []byte {
+	base := s.JavaBaseClass
+	if base == "" {
+		base = defaultJavaBaseClass
+	}
+	baseName := base[strings.LastIndex(base, ".")+1:]
+	class := javaClassName(p)
+
+	helpers := make(map[string]bool)
+	for _, f := range p.Fields {
+		if h := javaCodecs[f.Type].helper; h != "" {
+			helpers[h] = true
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by stargate-packetgen from %s. DO NOT EDIT.\n\n", source)
+	if s.JavaPackage != "" {
+		fmt.Fprintf(&b, "package %s;\n\n", s.JavaPackage)
+	}
+	fmt.Fprintf(&b, "import %s;\nimport io.netty.buffer.ByteBuf;\n", base)
+	if helpers["String"] || helpers["StringArray"] {
+		b.WriteString("\nimport java.nio.charset.StandardCharsets;\n")
+	}
+	b.WriteString("\n")
+
+	doc := p.Doc
+	if doc == "" {
+		doc = fmt.Sprintf("%s is a packet generated from %s.", class, source)
+	}
+	b.WriteString("/**\n")
+	for _, line := range strings.Split(strings.TrimSpace(doc), "\n") {
+		fmt.Fprintf(&b, " * %s\n", strings.TrimSpace(line))
+	}
+	b.WriteString(" */\n")
+	fmt.Fprintf(&b, "public class %s extends %s {\n\n", class, baseName)
+	fmt.Fprintf(&b, "    public static final byte ID = (byte) 0x%02x;\n\n", p.ID)
+
+	for _, f := range p.Fields {
+		fmt.Fprintf(&b, "    private %s %s;\n", fieldTypes[f.Type].javaType, lowerFirst(f.Name))
+	}
+	if len(p.Fields) != 0 {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("    @Override\n    public void encodePayload(ByteBuf byteBuf) {\n")
+	for _, f := range p.Fields {
+		fmt.Fprintf(&b, "        "+javaCodecs[f.Type].write+"\n", lowerFirst(f.Name))
+	}
+	b.WriteString("    }\n\n")
+
+	b.WriteString("    @Override\n    public void decodePayload(ByteBuf byteBuf) {\n")
+	for _, f := range p.Fields {
+		fmt.Fprintf(&b, "        this.%s = %s;\n", lowerFirst(f.Name), javaCodecs[f.Type].read)
+	}
+	b.WriteString("    }\n\n")
+
+	b.WriteString("    @Override\n    public byte getPacketId() {\n        return ID;\n    }\n")
+
+	for _, f := range p.Fields {
+		name := lowerFirst(f.Name)
+		typ := fieldTypes[f.Type].javaType
+		getter := "get"
+		if typ == "boolean" {
+			getter = "is"
+		}
+		fmt.Fprintf(&b, "\n    public %s %s%s() {\n        return this.%s;\n    }\n", typ, getter, f.Name, name)
+		fmt.Fprintf(&b, "\n    public void set%s(%s %s) {\n        this.%s = %s;\n    }\n", f.Name, typ, name, name, name)
+	}
+
+	names := make([]string, 0, len(helpers))
+	for h := range helpers {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+	for _, h := range names {
+		b.WriteString("\n")
+		b.WriteString(javaHelpers[h])
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
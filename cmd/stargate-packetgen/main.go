@@ -0,0 +1,97 @@
+// Command stargate-packetgen generates packets from a schema file, so that the Go packets and the classes of
+// the StarGate plugin cannot drift apart. It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/alvin0319/go-stargate-server/cmd/stargate-packetgen -schema packets.toml
+//
+// For each packet of the schema, it writes a Go file with the Read, Write and ID methods in the style of the
+// built-in packets, and a file declaring the packet IDs and RegisterPackets, which registers every packet to a
+// protocol.Registry. If -java is set, it also writes the Java class of each packet to the directory.
+//
+// The Java output is experimental. The classes are only compared with the golden files under testdata/java and
+// have not been compiled against alemiz.stargate.protocol.StarGatePacket, so they may not implement every
+// abstract method of the StarGate version in use. Compile them with the plugin and check a round trip against
+// the Go packets before relying on them.
+//
+// The schema is a TOML file:
+//
+//	Package = "packets"
+//	JavaPackage = "com.example.stargate.packets"
+//
+//	[[Packets]]
+//	Name = "PlayerScore"
+//	ID = 0x64
+//	Doc = "PlayerScore is sent when the score of a player changes."
+//
+//	  [[Packets.Fields]]
+//	  Name = "PlayerName"
+//	  Type = "string"
+//
+//	  [[Packets.Fields]]
+//	  Name = "Score"
+//	  Type = "int32"
+//
+// Packet names must not collide with each other once converted to file names, nor declare an identifier, such as
+// the ID<Name> constant, that another packet or, if Package is protocol, the protocol package already declares.
+//
+// Fields are encoded in the order they are listed. Field names must not be ID, Read or Write, which are the
+// methods of the packet. Type is one of bool, byte, int16, uint16, int32, uint32, int64, uint64, float32,
+// float64, string, bytes, []string, []int32 and []int64.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "packets.toml", "path of the schema file")
+	out := flag.String("out", ".", "directory to write the Go files to")
+	javaOut := flag.String("java", "", "directory to write the experimental Java classes to, if set")
+	flag.Parse()
+
+	if err := run(*schemaPath, *out, *javaOut); err != nil {
+		fmt.Fprintln(os.Stderr, "stargate-packetgen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the packets of the schema at schemaPath.
+func run(schemaPath, out, javaOut string) error {
+	s, err := readSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	source := filepath.Base(schemaPath)
+
+	files := make(map[string][]byte)
+	for _, p := range s.Packets {
+		b, err := goPacket(s, p, source)
+		if err != nil {
+			return fmt.Errorf("packet %s: %w", p.Name, err)
+		}
+		files[filepath.Join(out, snakeCase(p.Name)+"_gen.go")] = b
+	}
+	b, err := goRegistry(s, source)
+	if err != nil {
+		return err
+	}
+	files[filepath.Join(out, "packets_gen.go")] = b
+
+	if javaOut != "" {
+		for _, p := range s.Packets {
+			files[filepath.Join(javaOut, javaClassName(p)+".java")] = javaPacket(s, p, source)
+		}
+	}
+
+	for path, b := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenGo and goldenJava are the expected output of testdata/packets.toml.
+// goldenGo is a package of its own, so that it is compiled by TestGeneratedGoCompiles.
+const (
+	goldenGo   = "testdata/packets"
+	goldenJava = "testdata/java"
+)
+
+func TestRun(t *testing.T) {
+	out, javaOut := t.TempDir(), t.TempDir()
+	if err := run("testdata/packets.toml", out, javaOut); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		for dir, golden := range map[string]string{out: goldenGo, javaOut: goldenJava} {
+			if err := os.RemoveAll(golden); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.CopyFS(golden, os.DirFS(dir)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	compareDir(t, out, goldenGo)
+	compareDir(t, javaOut, goldenJava)
+}
+
+// compareDir compares the files generated in dir with the golden files.
+func compareDir(t *testing.T, dir, golden string) {
+	t.Helper()
+	got, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := filepath.Glob(filepath.Join(golden, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(paths []string) []string {
+		for i, p := range paths {
+			paths[i] = filepath.Base(p)
+		}
+		return paths
+	}
+	if g, w := names(got), names(want); !slices.Equal(g, w) {
+		t.Fatalf("generated files %v, want %v", g, w)
+	}
+	for _, name := range got {
+		g, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := os.ReadFile(filepath.Join(golden, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(g, w) {
+			t.Errorf("%s differs from %s, run go test -update to update it:\n%s", name, golden, g)
+		}
+	}
+}
+
+func TestGeneratedGoCompiles(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	// The golden package is in testdata, so it is only built when named explicitly.
+	cmd := exec.Command(goTool, "vet", "./"+goldenGo)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet %s: %v\n%s", goldenGo, err, b)
+	}
+}
+
+func TestRunInvalidSchema(t *testing.T) {
+	tests := []struct {
+		name, schema, want string
+	}{
+		{"package", `Package = "not a package"`, "invalid package name"},
+		{"builtin ID", "Package = \"p\"\n[[Packets]]\nName = \"Ping\"\nID = 0x04", "built-in packet"},
+		{"duplicate ID", "Package = \"p\"\n[[Packets]]\nName = \"A\"\nID = 0x64\n[[Packets]]\nName = \"B\"\nID = 0x64", "already used by A"},
+		{"field method", "Package = \"p\"\n[[Packets]]\nName = \"A\"\nID = 0x64\n[[Packets.Fields]]\nName = \"ID\"\nType = \"int32\"", "field name ID is a method of the packet"},
+		{"field type", "Package = \"p\"\n[[Packets]]\nName = \"A\"\nID = 0x64\n[[Packets.Fields]]\nName = \"F\"\nType = \"int8\"", "unknown type"},
+		{"file name", "Package = \"p\"\n[[Packets]]\nName = \"HTTPServer\"\nID = 0x64\n[[Packets]]\nName = \"HttpServer\"\nID = 0x65", "file http_server_gen.go is already written by packet HTTPServer"},
+		{"registration file", "Package = \"p\"\n[[Packets]]\nName = \"Packets\"\nID = 0x64", "already written by the registration file"},
+		{"ID identifier", "Package = \"p\"\n[[Packets]]\nName = \"Score\"\nID = 0x64\n[[Packets]]\nName = \"IDScore\"\nID = 0x65", "IDScore is already declared by packet Score"},
+		{"protocol ID", "Package = \"protocol\"\n[[Packets]]\nName = \"Forward\"\nID = 0x64", "Forward is already declared by the protocol package"},
+		{"protocol type", "Package = \"protocol\"\n[[Packets]]\nName = \"Registry\"\nID = 0x64", "Registry is already declared by the protocol package"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "packets.toml")
+			if err := os.WriteFile(path, []byte(tt.schema), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := run(path, t.TempDir(), "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
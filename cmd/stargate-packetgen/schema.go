@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/pelletier/go-toml"
+)
+
+// Schema is the list of packets read from a schema file.
+type Schema struct {
+	// Package is the name of the generated Go package.
+	Package string `toml:"Package"`
+	// JavaPackage is the package of the generated Java classes.
+	JavaPackage string `toml:"JavaPackage"`
+	// JavaBaseClass is the fully qualified class the generated Java classes extend.
+	JavaBaseClass string   `toml:"JavaBaseClass"`
+	Packets       []Packet `toml:"Packets"`
+}
+
+// Packet is a single packet in the schema.
+type Packet struct {
+	// Name is the name of the Go type. The Java class is named with the Packet suffix.
+	Name string `toml:"Name"`
+	// ID is the packet ID. It must not collide with the built-in packets.
+	ID     uint64  `toml:"ID"`
+	Doc    string  `toml:"Doc"`
+	Fields []Field `toml:"Fields"`
+}
+
+// Field is a single field of the packet, encoded in the order listed in the schema.
+type Field struct {
+	Name string `toml:"Name"`
+	// Type is one of the keys of fieldTypes.
+	Type string `toml:"Type"`
+	Doc  string `toml:"Doc"`
+}
+
+// fieldType is the encoding of a field type in the generated code.
+type fieldType struct {
+	// goType is the Go type of the field.
+	goType string
+	// util is the suffix of the util Read and Write functions.
+	util string
+	// javaType is the Java type of the field.
+	javaType string
+}
+
+// fieldTypes maps the types allowed in the schema to their encodings.
+var fieldTypes = map[string]fieldType{
+	"bool":     {goType: "bool", util: "Bool", javaType: "boolean"},
+	"byte":     {goType: "byte", util: "Byte", javaType: "byte"},
+	"int16":    {goType: "int16", util: "Int16", javaType: "short"},
+	"uint16":   {goType: "uint16", util: "Uint16", javaType: "int"},
+	"int32":    {goType: "int32", util: "Int32", javaType: "int"},
+	"uint32":   {goType: "uint32", util: "Uint32", javaType: "long"},
+	"int64":    {goType: "int64", util: "Int64", javaType: "long"},
+	"uint64":   {goType: "uint64", util: "Uint64", javaType: "long"},
+	"float32":  {goType: "float32", util: "Float32", javaType: "float"},
+	"float64":  {goType: "float64", util: "Float64", javaType: "double"},
+	"string":   {goType: "string", util: "String", javaType: "String"},
+	"bytes":    {goType: "[]byte", util: "Bytes", javaType: "byte[]"},
+	"[]string": {goType: "[]string", util: "StringArray", javaType: "String[]"},
+	"[]int32":  {goType: "[]int32", util: "Int32Array", javaType: "int[]"},
+	"[]int64":  {goType: "[]int64", util: "Int64Array", javaType: "long[]"},
+}
+
+// packetMethods contains the methods of the generated packets, which fields must not be named after.
+var packetMethods = map[string]bool{"ID": true, "Read": true, "Write": true}
+
+// readSchema reads the Schema from the TOML file at path and validates it.
+func readSchema(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := toml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// validate returns an error if the schema cannot be generated or would fail to register.
+func (s *Schema) validate() error {
+	if !token.IsIdentifier(s.Package) {
+		return fmt.Errorf("invalid package name %q", s.Package)
+	}
+	builtin := protocol.DefaultRegistry()
+	// idents maps the identifiers declared by the generated code to what declares them, so that they do not
+	// collide with each other or with the protocol package if the packets are generated into it.
+	idents := map[string]string{"RegisterPackets": "the registration file"}
+	if s.Package == "protocol" {
+		declared, err := protocolIdents()
+		if err != nil {
+			return err
+		}
+		for _, ident := range declared {
+			idents[ident] = "the protocol package"
+		}
+	}
+	// goFiles and javaFiles map the names of the generated files to their packets. Java file names are compared
+	// in lower case, as they may be written to a case-insensitive file system.
+	goFiles := map[string]string{"packets": "the registration file"}
+	javaFiles := make(map[string]string)
+	names := make(map[string]bool)
+	ids := make(map[uint64]string)
+	for _, p := range s.Packets {
+		if !isExported(p.Name) {
+			return fmt.Errorf("packet name %q is not an exported identifier", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate packet name %s", p.Name)
+		}
+		names[p.Name] = true
+
+		for _, ident := range []string{p.Name, "ID" + p.Name} {
+			if other, ok := idents[ident]; ok {
+				return fmt.Errorf("packet %s: %s is already declared by %s", p.Name, ident, other)
+			}
+			idents[ident] = "packet " + p.Name
+		}
+		goFile := snakeCase(p.Name)
+		if other, ok := goFiles[goFile]; ok {
+			return fmt.Errorf("packet %s: file %s_gen.go is already written by %s", p.Name, goFile, other)
+		}
+		goFiles[goFile] = "packet " + p.Name
+		javaFile := strings.ToLower(javaClassName(p))
+		if other, ok := javaFiles[javaFile]; ok {
+			return fmt.Errorf("packet %s: class %s is already written by %s", p.Name, javaClassName(p), other)
+		}
+		javaFiles[javaFile] = "packet " + p.Name
+
+		if p.ID == protocol.IDUnknown || p.ID > 0xff {
+			return fmt.Errorf("packet %s: ID %d does not fit in a byte", p.Name, p.ID)
+		}
+		if _, ok := builtin.Lookup(p.ID); ok {
+			return fmt.Errorf("packet %s: ID %d is used by a built-in packet", p.Name, p.ID)
+		}
+		if other, ok := ids[p.ID]; ok {
+			return fmt.Errorf("packet %s: ID %d is already used by %s", p.Name, p.ID, other)
+		}
+		ids[p.ID] = p.Name
+
+		fields := make(map[string]bool)
+		for _, f := range p.Fields {
+			if !isExported(f.Name) {
+				return fmt.Errorf("packet %s: field name %q is not an exported identifier", p.Name, f.Name)
+			}
+			if packetMethods[f.Name] {
+				return fmt.Errorf("packet %s: field name %s is a method of the packet", p.Name, f.Name)
+			}
+			if fields[f.Name] {
+				return fmt.Errorf("packet %s: duplicate field %s", p.Name, f.Name)
+			}
+			fields[f.Name] = true
+			if _, ok := fieldTypes[f.Type]; !ok {
+				return fmt.Errorf("packet %s: field %s has unknown type %q", p.Name, f.Name, f.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// protocolIdents returns the top-level identifiers declared by the protocol package, apart from the files
+// generated by stargate-packetgen, which are overwritten if the packets are generated into it again.
+func protocolIdents() ([]string, error) {
+	pkg, err := build.Import(protocolImport, ".", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the protocol package: %w", err)
+	}
+	var idents []string
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if generatedByPacketgen(f) {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					idents = append(idents, decl.Name.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						idents = append(idents, spec.Name.Name)
+					case *ast.ValueSpec:
+						for _, n := range spec.Names {
+							idents = append(idents, n.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return idents, nil
+}
+
+// generatedByPacketgen reports whether the file was generated by stargate-packetgen.
+func generatedByPacketgen(f *ast.File) bool {
+	return ast.IsGenerated(f) && len(f.Comments) > 0 && strings.HasPrefix(f.Comments[0].Text(), "Code generated by stargate-packetgen")
+}
+
+// isExported reports whether the name is an exported Go identifier.
+func isExported(name string) bool {
+	return token.IsIdentifier(name) && token.IsExported(name)
+}
+
+// snakeCase converts the Go name to the snake case used for file names, e.g. PlayerScore to player_score.
+func snakeCase(name string) string {
+	var sb strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word on a lower to upper change, or at the last upper case letter of an acronym.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// lowerFirst returns the name with its leading upper case word in lower case, used for Java field names,
+// e.g. PlayerName to playerName and URLPath to urlPath.
+func lowerFirst(name string) string {
+	r := []rune(name)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) {
+		// Keep the last upper case letter of the acronym as the start of the next word.
+		n--
+	}
+	for i := 0; i < n; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
@@ -0,0 +1,63 @@
+// Code generated by stargate-packetgen from packets.toml. DO NOT EDIT.
+
+package com.example.stargate.packets;
+
+import alemiz.stargate.protocol.StarGatePacket;
+import io.netty.buffer.ByteBuf;
+
+import java.nio.charset.StandardCharsets;
+
+/**
+ * PlayerScore is sent when the score of a player changes.
+ */
+public class PlayerScorePacket extends StarGatePacket {
+
+    public static final byte ID = (byte) 0x64;
+
+    private String playerName;
+    private int score;
+
+    @Override
+    public void encodePayload(ByteBuf byteBuf) {
+        writeString(byteBuf, this.playerName);
+        byteBuf.writeInt(this.score);
+    }
+
+    @Override
+    public void decodePayload(ByteBuf byteBuf) {
+        this.playerName = readString(byteBuf);
+        this.score = byteBuf.readInt();
+    }
+
+    @Override
+    public byte getPacketId() {
+        return ID;
+    }
+
+    public String getPlayerName() {
+        return this.playerName;
+    }
+
+    public void setPlayerName(String playerName) {
+        this.playerName = playerName;
+    }
+
+    public int getScore() {
+        return this.score;
+    }
+
+    public void setScore(int score) {
+        this.score = score;
+    }
+
+    private static void writeString(ByteBuf byteBuf, String value) {
+        byte[] bytes = value == null ? new byte[0] : value.getBytes(StandardCharsets.UTF_8);
+        byteBuf.writeInt(bytes.length);
+        byteBuf.writeBytes(bytes);
+    }
+
+    private static String readString(ByteBuf byteBuf) {
+        int length = byteBuf.readInt();
+        return byteBuf.readCharSequence(length, StandardCharsets.UTF_8).toString();
+    }
+}
@@ -0,0 +1,173 @@
+// Code generated by stargate-packetgen from packets.toml. DO NOT EDIT.
+
+package packets
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// AllTypes is a packet generated from packets.toml.
+type AllTypes struct {
+	Bool    bool
+	Byte    byte
+	Int16   int16
+	Uint16  uint16
+	Int32   int32
+	Uint32  uint32
+	Int64   int64
+	Uint64  uint64
+	Float32 float32
+	Float64 float64
+	URLPath string
+	Bytes   []byte
+	Strings []string
+	Int32s  []int32
+	Int64s  []int64
+}
+
+func (p *AllTypes) Read(r io.Reader) error {
+	var err error
+
+	p.Bool, err = util.ReadBool(r)
+	if err != nil {
+		return err
+	}
+
+	p.Byte, err = util.ReadByte(r)
+	if err != nil {
+		return err
+	}
+
+	p.Int16, err = util.ReadInt16(r)
+	if err != nil {
+		return err
+	}
+
+	p.Uint16, err = util.ReadUint16(r)
+	if err != nil {
+		return err
+	}
+
+	p.Int32, err = util.ReadInt32(r)
+	if err != nil {
+		return err
+	}
+
+	p.Uint32, err = util.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+
+	p.Int64, err = util.ReadInt64(r)
+	if err != nil {
+		return err
+	}
+
+	p.Uint64, err = util.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+
+	p.Float32, err = util.ReadFloat32(r)
+	if err != nil {
+		return err
+	}
+
+	p.Float64, err = util.ReadFloat64(r)
+	if err != nil {
+		return err
+	}
+
+	p.URLPath, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.Bytes, err = util.ReadBytes(r)
+	if err != nil {
+		return err
+	}
+
+	p.Strings, err = util.ReadStringArray(r)
+	if err != nil {
+		return err
+	}
+
+	p.Int32s, err = util.ReadInt32Array(r)
+	if err != nil {
+		return err
+	}
+
+	p.Int64s, err = util.ReadInt64Array(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *AllTypes) Write(w io.Writer) error {
+	if err := util.WriteBool(w, p.Bool); err != nil {
+		return err
+	}
+
+	if err := util.WriteByte(w, p.Byte); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt16(w, p.Int16); err != nil {
+		return err
+	}
+
+	if err := util.WriteUint16(w, p.Uint16); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt32(w, p.Int32); err != nil {
+		return err
+	}
+
+	if err := util.WriteUint32(w, p.Uint32); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt64(w, p.Int64); err != nil {
+		return err
+	}
+
+	if err := util.WriteUint64(w, p.Uint64); err != nil {
+		return err
+	}
+
+	if err := util.WriteFloat32(w, p.Float32); err != nil {
+		return err
+	}
+
+	if err := util.WriteFloat64(w, p.Float64); err != nil {
+		return err
+	}
+
+	if err := util.WriteString(w, p.URLPath); err != nil {
+		return err
+	}
+
+	if err := util.WriteBytes(w, p.Bytes); err != nil {
+		return err
+	}
+
+	if err := util.WriteStringArray(w, p.Strings); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt32Array(w, p.Int32s); err != nil {
+		return err
+	}
+
+	return util.WriteInt64Array(w, p.Int64s)
+}
+
+func (*AllTypes) ID() uint64 {
+	return IDAllTypes
+}
@@ -0,0 +1,44 @@
+// Code generated by stargate-packetgen from packets.toml. DO NOT EDIT.
+
+package packets
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// PlayerScore is sent when the score of a player changes.
+type PlayerScore struct {
+	// PlayerName is the name of the player.
+	PlayerName string
+	Score      int32
+}
+
+func (p *PlayerScore) Read(r io.Reader) error {
+	var err error
+
+	p.PlayerName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.Score, err = util.ReadInt32(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PlayerScore) Write(w io.Writer) error {
+	if err := util.WriteString(w, p.PlayerName); err != nil {
+		return err
+	}
+
+	return util.WriteInt32(w, p.Score)
+}
+
+func (*PlayerScore) ID() uint64 {
+	return IDPlayerScore
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
 	"os"
 
@@ -8,9 +11,65 @@ import (
 )
 
 type Config struct {
-	Host     string `toml:host`
-	Port     int    `toml:port`
-	Password string `toml:password`
+	Host     string `toml:"Host"`
+	Port     int    `toml:"Port"`
+	Password string `toml:"Password"`
+	// Clients maps client names to their own passwords.
+	// If not empty, clients missing in it are rejected unless AllowUnknownClients is set,
+	// in which case they are authenticated with Password.
+	Clients             map[string]string `toml:"Clients"`
+	AllowUnknownClients bool              `toml:"AllowUnknownClients"`
+	// RequireChallengeAuth denies clients sending their password in plain text,
+	// requiring them to authenticate by challenge-response.
+	RequireChallengeAuth bool `toml:"RequireChallengeAuth"`
+	// DuplicateNames is the policy applied when a client connects with a name already in use.
+	// It is one of "reject", "kick" or "suffix".
+	DuplicateNames string    `toml:"DuplicateNames"`
+	TLS            TLSConfig `toml:"TLS"`
+}
+
+// TLSConfig is the TLS settings of the listener.
+type TLSConfig struct {
+	Enabled  bool   `toml:"Enabled"`
+	CertFile string `toml:"CertFile"`
+	KeyFile  string `toml:"KeyFile"`
+	// ClientCAFile is the CA bundle to verify client certificates with. If set, clients must present a certificate.
+	ClientCAFile string `toml:"ClientCAFile"`
+	// VerifyClientName requires the client certificate to match the client name sent in the handshake.
+	VerifyClientName bool `toml:"VerifyClientName"`
+}
+
+// Load loads the certificates and returns the *tls.Config for the listener, or nil if TLS is disabled.
+// VerifyClientName requires both Enabled and ClientCAFile, as client names can only be verified against
+// certificates checked with the CA.
+func (c TLSConfig) Load() (*tls.Config, error) {
+	if c.VerifyClientName && (!c.Enabled || c.ClientCAFile == "") {
+		return nil, fmt.Errorf("VerifyClientName requires TLS to be enabled with ClientCAFile")
+	}
+	if !c.Enabled {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.ClientCAFile != "" {
+		b, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
 }
 
 // Read reads the Config from config.toml of current working directory and returns error if failed to read config.
@@ -19,6 +78,8 @@ func Read() (*Config, error) {
 		Host:     "0.0.0.0",
 		Port:     47007,
 		Password: "123456789",
+
+		DuplicateNames: "reject",
 	}
 	if _, err := os.Stat("config.toml"); os.IsNotExist(err) {
 		b, err := toml.Marshal(zero)
@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestTLSConfigLoadVerifyClientName(t *testing.T) {
+	tests := []struct {
+		name string
+		conf TLSConfig
+	}{
+		{"disabled", TLSConfig{VerifyClientName: true}},
+		{"disabled with CA", TLSConfig{VerifyClientName: true, ClientCAFile: "ca.pem"}},
+		{"no CA", TLSConfig{Enabled: true, CertFile: "cert.pem", KeyFile: "key.pem", VerifyClientName: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := tt.conf.Load()
+			if err == nil {
+				t.Fatalf("got %v, want error", conf)
+			}
+		})
+	}
+}
+
+func TestTLSConfigLoadDisabled(t *testing.T) {
+	conf, err := TLSConfig{}.Load()
+	if conf != nil || err != nil {
+		t.Errorf("got %v, %v, want nil, nil", conf, err)
+	}
+}
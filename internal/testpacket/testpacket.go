@@ -0,0 +1,22 @@
+// Package testpacket contains the packets shared by the tests of several packages.
+package testpacket
+
+import "io"
+
+// IDPanic is the ID Panic is registered with.
+const IDPanic = 0x64
+
+// Panic is a packet whose Read panics after reading the first byte of its body, like a custom packet
+// with a bug would. An empty body fails with the read error instead.
+type Panic struct{}
+
+func (*Panic) Read(r io.Reader) error {
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil {
+		return err
+	}
+	panic("corrupted packet")
+}
+
+func (*Panic) Write(io.Writer) error { return nil }
+func (*Panic) ID() uint64            { return IDPanic }
@@ -29,7 +29,39 @@ func main() {
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 	log := slog.Default()
 	log.Info("starting stargate server", "host", conf.Host, "port", conf.Port)
-	l, err := server.Listen(conf.Host+":"+strconv.Itoa(conf.Port), conf.Password)
+	var auth server.Authenticator = server.PasswordAuthenticator{Password: conf.Password}
+	if len(conf.Clients) > 0 {
+		a := server.CredentialAuthenticator{Credentials: conf.Clients}
+		if conf.AllowUnknownClients {
+			a.FallbackPassword = conf.Password
+		}
+		auth = a
+	}
+	tlsConf, err := conf.TLS.Load()
+	if err != nil {
+		panic(err)
+	}
+	if conf.TLS.VerifyClientName {
+		auth = server.CertificateAuthenticator{Authenticator: auth}
+	}
+	var duplicateNames server.DuplicateNamePolicy
+	switch conf.DuplicateNames {
+	case "", "reject":
+		duplicateNames = server.DuplicateReject
+	case "kick":
+		duplicateNames = server.DuplicateKickOld
+	case "suffix":
+		duplicateNames = server.DuplicateSuffix
+	default:
+		panic("unknown duplicate names policy: " + conf.DuplicateNames)
+	}
+	l, err := server.ListenConfig{
+		Authenticator:    auth,
+		TLSConfig:        tlsConf,
+		RequireChallenge: conf.RequireChallengeAuth,
+		DuplicateNames:   duplicateNames,
+		Middlewares:      []server.Middleware{server.Recover},
+	}.Listen(conf.Host + ":" + strconv.Itoa(conf.Port))
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// AuthChallenge is a packet sent by server in response to a Handshake that requested challenge-response
+// authentication. The client answers it with AuthResponse.
+type AuthChallenge struct {
+	// Nonce is the random nonce the client has to prove the knowledge of secret with.
+	Nonce []byte
+}
+
+func (p *AuthChallenge) Read(r io.Reader) error {
+	var err error
+	p.Nonce, err = util.ReadBytes(r)
+	return err
+}
+
+func (p *AuthChallenge) Write(w io.Writer) error {
+	return util.WriteBytes(w, p.Nonce)
+}
+
+func (*AuthChallenge) ID() uint64 {
+	return IDAuthChallenge
+}
+
+// AuthResponse is a packet sent by client in response to AuthChallenge.
+type AuthResponse struct {
+	// Proof is the proof computed by ChallengeProof.
+	Proof []byte
+}
+
+func (p *AuthResponse) Read(r io.Reader) error {
+	var err error
+	p.Proof, err = util.ReadBytes(r)
+	return err
+}
+
+func (p *AuthResponse) Write(w io.Writer) error {
+	return util.WriteBytes(w, p.Proof)
+}
+
+func (*AuthResponse) ID() uint64 {
+	return IDAuthResponse
+}
+
+// ChallengeProof returns the HMAC-SHA256 of the nonce followed by the client name, keyed with the secret.
+func ChallengeProof(secret string, nonce []byte, clientName string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(nonce)
+	mac.Write([]byte(clientName))
+	return mac.Sum(nil)
+}
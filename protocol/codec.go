@@ -0,0 +1,527 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// Marshal writes the exported fields of the struct pointed to by v, using the encodings of util.
+// It allows custom packets to be declared as plain structs:
+//
+//	type CustomPacket struct {
+//		PlayerName string
+//		Score      int32
+//		Tags       []string
+//	}
+//
+//	func (p *CustomPacket) Read(r io.Reader) error  { return protocol.Unmarshal(r, p) }
+//	func (p *CustomPacket) Write(w io.Writer) error { return protocol.Marshal(w, p) }
+//	func (*CustomPacket) ID() uint64               { return 100 }
+//
+// Fields are encoded in the order they are declared, with the type following the Go type of field:
+// bool as a byte, int8 as a signed byte, uint8 as an unsigned byte, intN, uintN and floatN as big-endian values, string and []byte
+// with an int32 length prefix, slices of strings, int32 and int64 (including named element types) as util arrays, structs as their fields,
+// and slices of structs with an int32 count prefix.
+//
+// The encoding of each field can be changed with the "stargate" struct tag, which holds comma-separated options:
+//
+//	Field int    `stargate:"type=int16"` // encodes an integer field as int8, byte, int16, uint16, int32, uint32, int64 or uint64
+//	Field string `stargate:"order=2"`    // encodes fields in ascending order instead of declaration order
+//	Field string `stargate:"-"`          // skips the field
+//
+// Fields of type int and uint must have the type option. If any field has the order option, all of them must.
+// The byte type is unsigned and int8 is signed in both directions. An integer that does not fit the wire type
+// of its field fails to marshal, and one that does not fit the field fails to unmarshal.
+func Marshal(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("marshal: expected non-nil pointer to struct, got %T", v)
+	}
+	p, err := planFor(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+	return p.write(w, rv.Elem())
+}
+
+// Unmarshal reads the exported fields of the struct pointed to by v, in the encoding described in Marshal.
+func Unmarshal(r io.Reader, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal: expected non-nil pointer to struct, got %T", v)
+	}
+	p, err := planFor(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+	return p.read(r, rv.Elem())
+}
+
+// wireType is the encoding of a single field.
+type wireType int
+
+const (
+	wireBool wireType = iota
+	wireInt8
+	wireByte
+	wireInt16
+	wireUint16
+	wireInt32
+	wireUint32
+	wireInt64
+	wireUint64
+	wireFloat32
+	wireFloat64
+	wireString
+	wireBytes
+	wireStringArray
+	wireInt32Array
+	wireInt64Array
+	wireStruct
+	wireStructArray
+)
+
+// integerTypes maps the names accepted by the type option to their wire types.
+var integerTypes = map[string]wireType{
+	"int8":   wireInt8,
+	"byte":   wireByte,
+	"int16":  wireInt16,
+	"uint16": wireUint16,
+	"int32":  wireInt32,
+	"uint32": wireUint32,
+	"int64":  wireInt64,
+	"uint64": wireUint64,
+}
+
+// codecField is a single field of the struct encoded by a codecPlan.
+type codecField struct {
+	index int
+	name  string
+	wire  wireType
+	order int
+	// elem is the plan of struct, or of the element of slice of structs.
+	elem *codecPlan
+}
+
+// codecPlan is the list of fields of a struct in the order they are encoded.
+type codecPlan struct {
+	fields []codecField
+}
+
+// plans caches the codecPlan of each struct type.
+var plans sync.Map
+
+// planFor returns the codecPlan of the struct type.
+func planFor(t reflect.Type) (*codecPlan, error) {
+	if p, ok := plans.Load(t); ok {
+		return p.(*codecPlan), nil
+	}
+	p, err := newPlan(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	plans.Store(t, p)
+	return p, nil
+}
+
+// newPlan builds the codecPlan of the struct type. seen contains the types being built, to reject recursive types.
+func newPlan(t reflect.Type, seen []reflect.Type) (*codecPlan, error) {
+	if slices.Contains(seen, t) {
+		return nil, fmt.Errorf("recursive struct type %s", t)
+	}
+	seen = append(seen, t)
+
+	p := &codecPlan{}
+	ordered := 0
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("stargate")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		f := codecField{index: i, name: sf.Name, order: i}
+
+		var typeName string
+		var hasOrder bool
+		if tag != "" {
+			for _, opt := range strings.Split(tag, ",") {
+				key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+				switch key {
+				case "type":
+					typeName = value
+				case "order":
+					n, err := strconv.Atoi(value)
+					if err != nil {
+						return nil, fmt.Errorf("codec: invalid order of %s.%s: %q", t, sf.Name, value)
+					}
+					f.order = n
+					hasOrder = true
+				default:
+					return nil, fmt.Errorf("codec: unknown option of %s.%s: %q", t, sf.Name, opt)
+				}
+			}
+		}
+		if hasOrder {
+			ordered++
+		}
+
+		var err error
+		f.wire, f.elem, err = wireTypeOf(sf.Type, typeName, seen)
+		if err != nil {
+			return nil, fmt.Errorf("codec: field %s.%s: %w", t, sf.Name, err)
+		}
+		p.fields = append(p.fields, f)
+	}
+	if ordered != 0 && ordered != len(p.fields) {
+		return nil, fmt.Errorf("codec: either all or none of the fields of %s must have the order option", t)
+	}
+	slices.SortStableFunc(p.fields, func(a, b codecField) int {
+		return a.order - b.order
+	})
+	return p, nil
+}
+
+// wireTypeOf returns the wire type of the Go type, optionally overridden by the type option.
+func wireTypeOf(t reflect.Type, typeName string, seen []reflect.Type) (wireType, *codecPlan, error) {
+	if typeName != "" {
+		wire, ok := integerTypes[typeName]
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown type %q", typeName)
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return wire, nil, nil
+		default:
+			return 0, nil, fmt.Errorf("type %q is only allowed on integers, not %s", typeName, t)
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return wireBool, nil, nil
+	case reflect.Int, reflect.Uint:
+		return 0, nil, fmt.Errorf("%s has no fixed size, set the type option", t)
+	case reflect.Int8:
+		return wireInt8, nil, nil
+	case reflect.Uint8:
+		return wireByte, nil, nil
+	case reflect.Int16:
+		return wireInt16, nil, nil
+	case reflect.Uint16:
+		return wireUint16, nil, nil
+	case reflect.Int32:
+		return wireInt32, nil, nil
+	case reflect.Uint32:
+		return wireUint32, nil, nil
+	case reflect.Int64:
+		return wireInt64, nil, nil
+	case reflect.Uint64:
+		return wireUint64, nil, nil
+	case reflect.Float32:
+		return wireFloat32, nil, nil
+	case reflect.Float64:
+		return wireFloat64, nil, nil
+	case reflect.String:
+		return wireString, nil, nil
+	case reflect.Struct:
+		p, err := newPlan(t, seen)
+		return wireStruct, p, err
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Uint8:
+			return wireBytes, nil, nil
+		case reflect.String:
+			return wireStringArray, nil, nil
+		case reflect.Int32:
+			return wireInt32Array, nil, nil
+		case reflect.Int64:
+			return wireInt64Array, nil, nil
+		case reflect.Struct:
+			p, err := newPlan(t.Elem(), seen)
+			return wireStructArray, p, err
+		}
+	}
+	return 0, nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func (p *codecPlan) write(w io.Writer, v reflect.Value) error {
+	for _, f := range p.fields {
+		if err := f.write(w, v.Field(f.index)); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (p *codecPlan) read(r io.Reader, v reflect.Value) error {
+	for _, f := range p.fields {
+		if err := f.read(r, v.Field(f.index)); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (f codecField) write(w io.Writer, v reflect.Value) error {
+	switch f.wire {
+	case wireBool:
+		return util.WriteBool(w, v.Bool())
+	case wireString:
+		return util.WriteString(w, v.String())
+	case wireFloat32:
+		return util.WriteFloat32(w, float32(v.Float()))
+	case wireFloat64:
+		return util.WriteFloat64(w, v.Float())
+	case wireBytes:
+		return util.WriteBytes(w, v.Bytes())
+	case wireStringArray:
+		arr := make([]string, v.Len())
+		for i := range arr {
+			arr[i] = v.Index(i).String()
+		}
+		return util.WriteStringArray(w, arr)
+	case wireInt32Array:
+		arr := make([]int32, v.Len())
+		for i := range arr {
+			arr[i] = int32(v.Index(i).Int())
+		}
+		return util.WriteInt32Array(w, arr)
+	case wireInt64Array:
+		arr := make([]int64, v.Len())
+		for i := range arr {
+			arr[i] = v.Index(i).Int()
+		}
+		return util.WriteInt64Array(w, arr)
+	case wireStruct:
+		return f.elem.write(w, v)
+	case wireStructArray:
+		if err := util.WriteInt32(w, int32(v.Len())); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := f.elem.write(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return f.writeInteger(w, v)
+}
+
+// integerRange is the range of values an integer wire type can hold.
+type integerRange struct {
+	name string
+	min  int64
+	max  uint64
+}
+
+// integerRanges maps the integer wire types to their ranges.
+var integerRanges = map[wireType]integerRange{
+	wireInt8:   {"int8", math.MinInt8, math.MaxInt8},
+	wireByte:   {"byte", 0, math.MaxUint8},
+	wireInt16:  {"int16", math.MinInt16, math.MaxInt16},
+	wireUint16: {"uint16", 0, math.MaxUint16},
+	wireInt32:  {"int32", math.MinInt32, math.MaxInt32},
+	wireUint32: {"uint32", 0, math.MaxUint32},
+	wireInt64:  {"int64", math.MinInt64, math.MaxInt64},
+	wireUint64: {"uint64", 0, math.MaxUint64},
+}
+
+// writeInteger writes the integer field in its wire type, returning an error if it overflows the wire type.
+func (f codecField) writeInteger(w io.Writer, v reflect.Value) error {
+	rng, ok := integerRanges[f.wire]
+	if !ok {
+		return fmt.Errorf("unknown wire type %d", f.wire)
+	}
+	var n int64
+	var u uint64
+	if v.CanInt() {
+		n = v.Int()
+		if n < rng.min || (n > 0 && uint64(n) > rng.max) {
+			return fmt.Errorf("value %d overflows %s", n, rng.name)
+		}
+		u = uint64(n)
+	} else {
+		u = v.Uint()
+		if u > rng.max {
+			return fmt.Errorf("value %d overflows %s", u, rng.name)
+		}
+		n = int64(u)
+	}
+	switch f.wire {
+	case wireInt8, wireByte:
+		return util.WriteByte(w, byte(u))
+	case wireInt16:
+		return util.WriteInt16(w, int16(n))
+	case wireUint16:
+		return util.WriteUint16(w, uint16(u))
+	case wireInt32:
+		return util.WriteInt32(w, int32(n))
+	case wireUint32:
+		return util.WriteUint32(w, uint32(u))
+	case wireInt64:
+		return util.WriteInt64(w, n)
+	default:
+		return util.WriteUint64(w, u)
+	}
+}
+
+func (f codecField) read(r io.Reader, v reflect.Value) error {
+	switch f.wire {
+	case wireBool:
+		b, err := util.ReadBool(r)
+		v.SetBool(b)
+		return err
+	case wireString:
+		s, err := util.ReadString(r)
+		v.SetString(s)
+		return err
+	case wireFloat32:
+		x, err := util.ReadFloat32(r)
+		v.SetFloat(float64(x))
+		return err
+	case wireFloat64:
+		x, err := util.ReadFloat64(r)
+		v.SetFloat(x)
+		return err
+	case wireBytes:
+		b, err := util.ReadBytes(r)
+		v.SetBytes(b)
+		return err
+	case wireStringArray:
+		arr, err := util.ReadStringArray(r)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, x := range arr {
+			s.Index(i).SetString(x)
+		}
+		v.Set(s)
+		return nil
+	case wireInt32Array:
+		arr, err := util.ReadInt32Array(r)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, x := range arr {
+			s.Index(i).SetInt(int64(x))
+		}
+		v.Set(s)
+		return nil
+	case wireInt64Array:
+		arr, err := util.ReadInt64Array(r)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, x := range arr {
+			s.Index(i).SetInt(x)
+		}
+		v.Set(s)
+		return nil
+	case wireStruct:
+		return f.elem.read(r, v)
+	case wireStructArray:
+		n, err := util.ReadInt32(r)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return &util.LengthError{Length: n, Err: util.ErrNegativeLength}
+		}
+		if limit := util.LimitsOf(r).MaxArrayLength; int(n) > limit {
+			return &util.LengthError{Length: n, Limit: limit, Err: util.ErrLengthExceedsMax}
+		}
+		s := reflect.MakeSlice(v.Type(), 0, 0)
+		for i := int32(0); i < n; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := f.elem.read(r, elem); err != nil {
+				return err
+			}
+			s = reflect.Append(s, elem)
+		}
+		v.Set(s)
+		return nil
+	}
+	return f.readInteger(r, v)
+}
+
+// readInteger reads the integer field in its wire type, returning an error if it overflows the field.
+func (f codecField) readInteger(r io.Reader, v reflect.Value) error {
+	var n int64
+	var u uint64
+	var signed bool
+	var err error
+	switch f.wire {
+	case wireInt8:
+		var b byte
+		b, err = util.ReadByte(r)
+		n, signed = int64(int8(b)), true
+	case wireByte:
+		var b byte
+		b, err = util.ReadByte(r)
+		u = uint64(b)
+	case wireInt16:
+		var x int16
+		x, err = util.ReadInt16(r)
+		n, signed = int64(x), true
+	case wireUint16:
+		var x uint16
+		x, err = util.ReadUint16(r)
+		u = uint64(x)
+	case wireInt32:
+		var x int32
+		x, err = util.ReadInt32(r)
+		n, signed = int64(x), true
+	case wireUint32:
+		var x uint32
+		x, err = util.ReadUint32(r)
+		u = uint64(x)
+	case wireInt64:
+		n, err = util.ReadInt64(r)
+		signed = true
+	case wireUint64:
+		u, err = util.ReadUint64(r)
+	default:
+		return fmt.Errorf("unknown wire type %d", f.wire)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v.CanInt() {
+		if !signed {
+			n = int64(u)
+			if n < 0 {
+				return fmt.Errorf("value %d overflows %s", u, v.Type())
+			}
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	}
+	if signed {
+		if n < 0 {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		u = uint64(n)
+	}
+	if v.OverflowUint(u) {
+		return fmt.Errorf("value %d overflows %s", u, v.Type())
+	}
+	v.SetUint(u)
+	return nil
+}
@@ -0,0 +1,276 @@
+package protocol_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+type codecInner struct {
+	Name  string
+	Value int64
+}
+
+type codecNames []string
+
+type codecName string
+
+type codecScore int32
+
+type codecStamp int64
+
+type codecAll struct {
+	Bool     bool
+	Int8     int8
+	Uint8    uint8
+	Int16    int16
+	Uint16   uint16
+	Int32    int32
+	Uint32   uint32
+	Int64    int64
+	Uint64   uint64
+	Float32  float32
+	Float64  float64
+	String   string
+	Bytes    []byte
+	Strings  []string
+	Names    codecNames
+	NameList []codecName
+	Scores   []codecScore
+	Stamps   []codecStamp
+	Int32s   []int32
+	Int64s   []int64
+	Inner    codecInner
+	Inners   []codecInner
+	Int      int    `stargate:"type=int16"`
+	Uint     uint   `stargate:"type=byte"`
+	Skipped  string `stargate:"-"`
+	internal string
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := codecAll{
+		Bool:     true,
+		Int8:     math.MinInt8,
+		Uint8:    math.MaxUint8,
+		Int16:    math.MinInt16,
+		Uint16:   math.MaxUint16,
+		Int32:    math.MinInt32,
+		Uint32:   math.MaxUint32,
+		Int64:    math.MinInt64,
+		Uint64:   math.MaxUint64,
+		Float32:  1.5,
+		Float64:  -2.25,
+		String:   "Steve",
+		Bytes:    []byte{1, 2, 3},
+		Strings:  []string{"a", "b"},
+		Names:    codecNames{"lobby"},
+		NameList: []codecName{"a", "b"},
+		Scores:   []codecScore{-1, math.MaxInt32},
+		Stamps:   []codecStamp{math.MinInt64},
+		Int32s:   []int32{-1, 1},
+		Int64s:   []int64{math.MaxInt64},
+		Inner:    codecInner{Name: "inner", Value: 7},
+		Inners:   []codecInner{{Name: "x", Value: 1}, {Name: "y", Value: 2}},
+		Int:      -300,
+		Uint:     200,
+		Skipped:  "skipped",
+	}
+	var buf bytes.Buffer
+	if err := protocol.Marshal(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	var out codecAll
+	if err := protocol.Unmarshal(bytes.NewReader(buf.Bytes()), &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+type codecOrdered struct {
+	B int32  `stargate:"order=2"`
+	A string `stargate:"order=1"`
+}
+
+type codecDeclared struct {
+	A string
+	B int32
+}
+
+func TestCodecOrder(t *testing.T) {
+	var ordered, declared bytes.Buffer
+	if err := protocol.Marshal(&ordered, &codecOrdered{A: "a", B: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.Marshal(&declared, &codecDeclared{A: "a", B: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ordered.Bytes(), declared.Bytes()) {
+		t.Errorf("got % x, want % x", ordered.Bytes(), declared.Bytes())
+	}
+}
+
+func TestCodecTagErrors(t *testing.T) {
+	type recursive struct {
+		Children []recursive
+	}
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"unknown option", &struct {
+			A string `stargate:"size=4"`
+		}{}, "unknown option"},
+		{"unknown type", &struct {
+			A int `stargate:"type=int24"`
+		}{}, "unknown type"},
+		{"type on string", &struct {
+			A string `stargate:"type=int32"`
+		}{}, "only allowed on integers"},
+		{"invalid order", &struct {
+			A string `stargate:"order=first"`
+		}{}, "invalid order"},
+		{"partial order", &struct {
+			A string `stargate:"order=1"`
+			B string
+		}{}, "all or none"},
+		{"int without type", &struct{ A int }{}, "set the type option"},
+		{"unsupported type", &struct{ A map[string]string }{}, "unsupported type"},
+		{"recursive type", &recursive{}, "recursive struct type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := protocol.Marshal(&bytes.Buffer{}, tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Marshal: got %v, want error containing %q", err, tt.want)
+			}
+			err = protocol.Unmarshal(bytes.NewReader(nil), tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Unmarshal: got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodecNotStructPointer(t *testing.T) {
+	for _, v := range []any{nil, codecDeclared{}, (*codecDeclared)(nil), new(int)} {
+		if err := protocol.Marshal(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("Marshal(%T) succeeded", v)
+		}
+		if err := protocol.Unmarshal(bytes.NewReader(nil), v); err == nil {
+			t.Errorf("Unmarshal(%T) succeeded", v)
+		}
+	}
+}
+
+type codecByte struct {
+	A int `stargate:"type=byte"`
+}
+
+type codecInt8 struct {
+	A uint `stargate:"type=int8"`
+}
+
+type codecUint16 struct {
+	A int32 `stargate:"type=uint16"`
+}
+
+type codecInt32 struct {
+	A uint64 `stargate:"type=int32"`
+}
+
+type codecSmallField struct {
+	A int8 `stargate:"type=int32"`
+}
+
+func TestCodecWriteOverflow(t *testing.T) {
+	tests := []any{
+		&codecByte{A: -1},
+		&codecByte{A: 256},
+		&codecInt8{A: 128},
+		&codecUint16{A: -1},
+		&codecUint16{A: math.MaxUint16 + 1},
+		&codecInt32{A: math.MaxInt32 + 1},
+	}
+	for _, v := range tests {
+		if err := protocol.Marshal(&bytes.Buffer{}, v); err == nil || !strings.Contains(err.Error(), "overflows") {
+			t.Errorf("Marshal(%+v): got %v, want overflow error", v, err)
+		}
+	}
+}
+
+func TestCodecReadOverflow(t *testing.T) {
+	tests := []struct {
+		v    any
+		data []byte
+	}{
+		// A byte is unsigned, so 0xff is 255 and overflows int8.
+		{&struct {
+			A int8 `stargate:"type=byte"`
+		}{}, []byte{0xff}},
+		// An int8 is signed, so 0xff is -1 and overflows uint.
+		{&codecInt8{}, []byte{0xff}},
+		{&codecSmallField{}, []byte{0, 0, 1, 0}},
+		{&codecInt32{}, []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		if err := protocol.Unmarshal(bytes.NewReader(tt.data), tt.v); err == nil || !strings.Contains(err.Error(), "overflows") {
+			t.Errorf("Unmarshal(% x) into %T: got %v, want overflow error", tt.data, tt.v, err)
+		}
+	}
+}
+
+func TestCodecByteSignedness(t *testing.T) {
+	tests := []struct {
+		v    any
+		data []byte
+		want any
+	}{
+		{&codecByte{}, []byte{0xff}, &codecByte{A: 255}},
+		{&struct{ A uint8 }{}, []byte{0xff}, &struct{ A uint8 }{A: 255}},
+		{&struct{ A int8 }{}, []byte{0xff}, &struct{ A int8 }{A: -1}},
+		{&struct {
+			A int `stargate:"type=int8"`
+		}{}, []byte{0xff}, &struct {
+			A int `stargate:"type=int8"`
+		}{A: -1}},
+	}
+	for _, tt := range tests {
+		if err := protocol.Unmarshal(bytes.NewReader(tt.data), tt.v); err != nil {
+			t.Fatalf("Unmarshal into %T: %v", tt.v, err)
+		}
+		if !reflect.DeepEqual(tt.v, tt.want) {
+			t.Errorf("got %+v, want %+v", tt.v, tt.want)
+		}
+		var buf bytes.Buffer
+		if err := protocol.Marshal(&buf, tt.v); err != nil {
+			t.Fatalf("Marshal(%+v): %v", tt.v, err)
+		}
+		if !bytes.Equal(buf.Bytes(), tt.data) {
+			t.Errorf("Marshal(%+v): got % x, want % x", tt.v, buf.Bytes(), tt.data)
+		}
+	}
+}
+
+func TestCodecStructArrayLength(t *testing.T) {
+	type list struct{ Items []codecInner }
+	for _, data := range [][]byte{
+		{0xff, 0xff, 0xff, 0xff},
+		{0x7f, 0xff, 0xff, 0xff},
+	} {
+		var lengthErr *util.LengthError
+		if err := protocol.Unmarshal(bytes.NewReader(data), &list{}); !errors.As(err, &lengthErr) {
+			t.Errorf("Unmarshal(% x): got %v, want LengthError", data, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package protocol
+
+import (
+	"bufio"
+	"io"
+)
+
+// Decoder reads packets from StarGate frames of an io.Reader. It is not safe for concurrent use.
+type Decoder struct {
+	r   *bufio.Reader
+	reg *Registry
+}
+
+// NewDecoder returns a new Decoder reading from r, decoding the packets in the registry.
+// Packets missing in the registry are decoded as Unknown. If reg is nil, DefaultRegistry is used.
+// The reader is buffered unless it is a *bufio.Reader already, so it must not be read from elsewhere.
+func NewDecoder(r io.Reader, reg *Registry) *Decoder {
+	if reg == nil {
+		reg = DefaultRegistry()
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{r: br, reg: reg}
+}
+
+// Decode reads the next frame and decodes its packet.
+func (d *Decoder) Decode() (*Wrapper, error) {
+	payload, err := d.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	return DecodePayload(payload, d.reg)
+}
+
+// ReadFrame reads the next frame and returns its payload without decoding it,
+// which may be decoded later with DecodePayload.
+func (d *Decoder) ReadFrame() ([]byte, error) {
+	return ReadFrame(d.r)
+}
@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+)
+
+// Encoder writes packets to an io.Writer as StarGate frames. It is not safe for concurrent use.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns a new Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode encodes the wrappers and writes their frames to the underlying writer with a single write.
+// Nothing is written if any of the wrappers fails to encode.
+func (e *Encoder) Encode(wrappers ...*Wrapper) error {
+	buf := e.buf[:0]
+	for _, wrapper := range wrappers {
+		var err error
+		buf, err = AppendFrame(buf, wrapper)
+		if err != nil {
+			return err
+		}
+	}
+	e.buf = buf
+	if len(buf) == 0 {
+		return nil
+	}
+	if _, err := e.w.Write(buf); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+	return nil
+}
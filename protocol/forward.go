@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// Forward is a packet that asks the server to deliver an encoded packet to another client.
+//
+// The target receives a Forward with the ClientName of the sender and the same Payload, so that it can tell who sent
+// the packet and reply with a Forward of its own. The Forward delivered never expects a response, but the payload keeps
+// the response ID it was encoded with, which the sender and the target may use to correlate their packets.
+//
+// If the packet cannot be delivered, because the target client is not connected, the payload cannot be decoded,
+// or it is a packet the server uses to control connections (Handshake to Forward, AuthChallenge and AuthResponse),
+// the server replies with a Forward that has the same ClientName and an empty Payload. The reply carries the response ID
+// of the Forward if it expected a response.
+type Forward struct {
+	// ClientName is the name of the target client in a Forward sent to the server,
+	// and the name of the sender in a Forward delivered by the server.
+	ClientName string
+	// Payload is the encoded packet to deliver, starting from the packet ID byte.
+	Payload []byte
+}
+
+func (p *Forward) Read(r io.Reader) error {
+	var err error
+
+	p.ClientName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.Payload, err = util.ReadBytes(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Forward) Write(w io.Writer) error {
+	if err := util.WriteString(w, p.ClientName); err != nil {
+		return err
+	}
+
+	return util.WriteBytes(w, p.Payload)
+}
+
+func (*Forward) ID() uint64 {
+	return IDForward
+}
@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+const (
+	// StarGateMagic is the magic that every frame starts with.
+	StarGateMagic = 0x0a20
+	// MaxPayloadLength is the max length of the payload of a single frame.
+	MaxPayloadLength = 1024 * 1024
+)
+
+// WriteFrame encodes the wrapper and writes it to the writer as a single frame.
+func WriteFrame(w io.Writer, wrapper *Wrapper) error {
+	frame, err := AppendFrame(nil, wrapper)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+	return nil
+}
+
+// AppendFrame encodes the wrapper as a single frame and appends it to dst, returning the extended slice.
+func AppendFrame(dst []byte, wrapper *Wrapper) ([]byte, error) {
+	payload, err := EncodePayload(wrapper)
+	if err != nil {
+		return dst, fmt.Errorf("failed to marshal packet: %w", err)
+	}
+	if len(payload) > MaxPayloadLength {
+		return dst, fmt.Errorf("payload length %d exceeds %d", len(payload), MaxPayloadLength)
+	}
+
+	// Write magic (2 bytes, big-endian)
+	dst = binary.BigEndian.AppendUint16(dst, StarGateMagic)
+	// Write length (4 bytes, big-endian)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	// Write payload
+	return append(dst, payload...), nil
+}
+
+// ReadFrame reads a single frame from the reader and returns its payload.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	// Read magic (2 bytes, big-endian)
+	var magic uint16
+	if err := binary.Read(r, binary.BigEndian, &magic); err != nil {
+		return nil, fmt.Errorf("failed to read magic: %w", err)
+	}
+	if magic != StarGateMagic {
+		return nil, fmt.Errorf("invalid magic: expected 0x%04x, got 0x%04x", StarGateMagic, magic)
+	}
+
+	// Read length (4 bytes, big-endian)
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("failed to read length: %w", err)
+	}
+
+	if length == 0 || length > MaxPayloadLength {
+		return nil, fmt.Errorf("invalid payload length: %d", length)
+	}
+
+	// Read payload. The buffer grows as the payload arrives, so that a peer announcing a large
+	// payload without sending it does not make us allocate it.
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, r, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	return payload.Bytes(), nil
+}
+
+// EncodePayload encodes the wrapper into the payload of a single frame, starting from the packet ID byte.
+// Unknown packets are encoded with their original packet ID so that they can be relayed as-is.
+func EncodePayload(wrapper *Wrapper) ([]byte, error) {
+	var payloadBuf bytes.Buffer
+
+	packetID := wrapper.P.ID()
+	if unknown, ok := wrapper.P.(*Unknown); ok {
+		packetID = unknown.PacketID
+	}
+	payloadBuf.WriteByte(byte(packetID))
+
+	if wrapper.Response {
+		payloadBuf.WriteByte(1)
+		responseIDBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(responseIDBytes, uint32(wrapper.ResponseID))
+		payloadBuf.Write(responseIDBytes)
+	} else {
+		payloadBuf.WriteByte(0)
+	}
+
+	if err := wrapper.P.Write(&payloadBuf); err != nil {
+		return nil, err
+	}
+	return payloadBuf.Bytes(), nil
+}
+
+// DecodePayload decodes the payload of a single frame, starting from the packet ID byte.
+// Packets missing in the registry are decoded as Unknown. A panic in the Read method of a packet
+// is returned as an error, so that a malformed packet cannot crash the reader.
+// The packets are read with the limits of the registry, see Registry.SetLimits.
+func DecodePayload(payload []byte, reg *Registry) (wrapper *Wrapper, err error) {
+	payloadBuf := bytes.NewReader(payload)
+
+	packetID, err := payloadBuf.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read packet ID: %w", err)
+	}
+
+	responseByte, err := payloadBuf.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response flag: %w", err)
+	}
+
+	wrapper = &Wrapper{
+		Response: responseByte != 0,
+	}
+
+	if wrapper.Response {
+		responseIDBytes := make([]byte, 4)
+		if _, err := io.ReadFull(payloadBuf, responseIDBytes); err != nil {
+			return nil, fmt.Errorf("failed to read response ID: %w", err)
+		}
+		wrapper.ResponseID = uint(binary.BigEndian.Uint32(responseIDBytes))
+	}
+
+	body := util.NewReader(payloadBuf, reg.Limits())
+	constructor, ok := reg.Lookup(uint64(packetID))
+	if !ok {
+		unknownPacket := &Unknown{PacketID: uint64(packetID)}
+		if err := unknownPacket.Read(body); err != nil {
+			return nil, fmt.Errorf("failed to read unknown packet: %w", err)
+		}
+		wrapper.P = unknownPacket
+		return wrapper, nil
+	}
+
+	packet := constructor()
+	defer func() {
+		if r := recover(); r != nil {
+			wrapper, err = nil, fmt.Errorf("failed to read packet %d: panic: %v", packetID, r)
+		}
+	}()
+	if err := packet.Read(body); err != nil {
+		return nil, fmt.Errorf("failed to read packet: %w", err)
+	}
+
+	wrapper.P = packet
+	return wrapper, nil
+}
@@ -0,0 +1,217 @@
+package protocol_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/internal/testpacket"
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/golden"
+)
+
+// panicRegistry returns the default registry with testpacket.Panic registered.
+func panicRegistry(tb testing.TB) *protocol.Registry {
+	reg := protocol.DefaultRegistry()
+	if err := reg.Register(testpacket.IDPanic, func() protocol.Packet { return &testpacket.Panic{} }); err != nil {
+		tb.Fatal(err)
+	}
+	return reg
+}
+
+// frame returns the frame announcing the length, followed by the payload.
+func frame(length uint32, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, protocol.StarGateMagic)
+	b = binary.BigEndian.AppendUint32(b, length)
+	return append(b, payload...)
+}
+
+// body returns the packet body of the golden frame, after the packet ID, response flag and response ID.
+func body(frame []byte) []byte {
+	payload := frame[6:]
+	if payload[1] != 0 {
+		return payload[6:]
+	}
+	return payload[2:]
+}
+
+func FuzzReadFrame(f *testing.F) {
+	for _, v := range golden.Vectors {
+		f.Add(v.Frame)
+	}
+	// A frame announcing the max length without sending it must not allocate it up front.
+	f.Add(frame(protocol.MaxPayloadLength, []byte{protocol.IDPing, 0}))
+	f.Add(frame(protocol.MaxPayloadLength+1, nil))
+	f.Add(frame(0xffffffff, nil))
+	f.Add(frame(0, nil))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		payload, err := protocol.ReadFrame(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(payload) == 0 || len(payload) > protocol.MaxPayloadLength {
+			t.Fatalf("read payload of invalid length %d", len(payload))
+		}
+		if !bytes.Equal(payload, data[6:6+len(payload)]) {
+			t.Fatalf("payload % x does not match the frame % x", payload, data)
+		}
+	})
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	for _, v := range golden.Vectors {
+		f.Add(v.Frame[6:])
+	}
+	// A packet panicking in Read must be returned as an error.
+	f.Add([]byte{testpacket.IDPanic, 0, 1})
+	f.Add([]byte{testpacket.IDPanic, 1, 0, 0, 0, 1, 1})
+	// A nested Forward is decoded like any other payload; the server refuses to deliver it.
+	f.Add([]byte{protocol.IDForward, 0, 0, 0, 0, 1, 'a', 0, 0, 0, 2, protocol.IDForward, 0})
+	f.Add([]byte{})
+
+	reg := panicRegistry(f)
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		w, err := protocol.DecodePayload(payload, reg)
+		if err != nil {
+			return
+		}
+		// Encoding the decoded packet must be stable, so that what is forwarded is what was decoded.
+		encoded, err := protocol.EncodePayload(w)
+		if err != nil {
+			t.Fatalf("failed to encode decoded %T: %v", w.P, err)
+		}
+		w2, err := protocol.DecodePayload(encoded, reg)
+		if err != nil {
+			t.Fatalf("failed to decode encoded %T: %v", w.P, err)
+		}
+		reencoded, err := protocol.EncodePayload(w2)
+		if err != nil {
+			t.Fatalf("failed to encode %T again: %v", w2.P, err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("encoding of %T is not stable:\n% x\n% x", w.P, encoded, reencoded)
+		}
+	})
+}
+
+func TestDecodePayloadRecoversPanic(t *testing.T) {
+	w, err := protocol.DecodePayload([]byte{testpacket.IDPanic, 0, 1}, panicRegistry(t))
+	if err == nil {
+		t.Fatalf("got %T, want error", w.P)
+	}
+}
+
+func TestReadFrameAllocatesAsPayloadArrives(t *testing.T) {
+	data := frame(protocol.MaxPayloadLength, make([]byte, 16))
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := protocol.ReadFrame(bytes.NewReader(data))
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want ErrUnexpectedEOF", err)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc >= protocol.MaxPayloadLength {
+		t.Errorf("allocated %d bytes for a frame of %d bytes", alloc, len(data))
+	}
+}
+
+// fuzzRead fuzzes the Read method of the packet returned by newPacket, seeded with the bodies
+// of its golden vectors. A packet read successfully must encode to bytes that read back the same.
+func fuzzRead(f *testing.F, newPacket func() protocol.Packet) {
+	id := newPacket().ID()
+	for _, v := range golden.Vectors {
+		if v.Wrapper.P.ID() == id {
+			f.Add(body(v.Frame))
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := newPacket()
+		if err := p.Read(bytes.NewReader(data)); err != nil {
+			return
+		}
+		var encoded bytes.Buffer
+		if err := p.Write(&encoded); err != nil {
+			t.Fatalf("failed to write read %T: %v", p, err)
+		}
+		p2 := newPacket()
+		if err := p2.Read(bytes.NewReader(encoded.Bytes())); err != nil {
+			t.Fatalf("failed to read written %T: %v", p, err)
+		}
+		var reencoded bytes.Buffer
+		if err := p2.Write(&reencoded); err != nil {
+			t.Fatalf("failed to write %T again: %v", p, err)
+		}
+		if !bytes.Equal(encoded.Bytes(), reencoded.Bytes()) {
+			t.Fatalf("encoding of %T is not stable:\n% x\n% x", p, encoded.Bytes(), reencoded.Bytes())
+		}
+	})
+}
+
+func FuzzHandshakeRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Handshake{} })
+}
+
+func FuzzServerHandshakeRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.ServerHandshake{} })
+}
+
+func FuzzDisconnectRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Disconnect{} })
+}
+
+func FuzzPingRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Ping{} })
+}
+
+func FuzzPongRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Pong{} })
+}
+
+func FuzzReconnectRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Reconnect{} })
+}
+
+func FuzzForwardRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.Forward{} })
+}
+
+func FuzzServerInfoRequestRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.ServerInfoRequest{} })
+}
+
+func FuzzServerInfoResponseRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.ServerInfoResponse{} })
+}
+
+func FuzzServerTransferRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.ServerTransfer{} })
+}
+
+func FuzzPlayerPingRequestRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.PlayerPingRequest{} })
+}
+
+func FuzzPlayerPingResponseRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.PlayerPingResponse{} })
+}
+
+func FuzzServerManageRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.ServerManage{} })
+}
+
+func FuzzAuthChallengeRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.AuthChallenge{} })
+}
+
+func FuzzAuthResponseRead(f *testing.F) {
+	fuzzRead(f, func() protocol.Packet { return &protocol.AuthResponse{} })
+}
@@ -0,0 +1,304 @@
+// Package golden contains byte vectors of every built-in packet, so that a change of byte order, length prefix
+// or field order in the Go encoding is noticed. The vectors are verified by the tests of this package.
+//
+// The vectors were written by hand from the encoding of the Java side, which uses Netty's big-endian
+// ByteBuf.writeInt and writeLong, and UTF-8 strings prefixed with their int32 length. A vector is only confirmed
+// against the StarGate Java implementation once a frame captured from it is added to testdata/captured.txt.
+// Until then it is labelled GoOnly, and only proves that the Go encoding did not change: it says nothing about
+// compatibility with the Java plugin. This matters most for Forward, ServerInfoRequest, ServerInfoResponse,
+// PlayerPingRequest, PlayerPingResponse, ServerManage and Reconnect, whose layouts were designed on the Go side
+// and may not match the plugin at all.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+)
+
+// Vector is a packet and its frame as encoded on the wire.
+type Vector struct {
+	// Name is the name of the vector, unique among Vectors.
+	Name string
+	// Wrapper is the packet encoded in Frame.
+	Wrapper *protocol.Wrapper
+	// Frame is the whole frame, starting from protocol.StarGateMagic.
+	Frame []byte
+	// GoOnly reports that Frame was not captured from the Java implementation yet, so that it is the Go encoding only.
+	GoOnly bool
+}
+
+// Verify checks the vector both ways: Wrapper must encode to Frame, and Frame must decode to Wrapper
+// using protocol.DefaultRegistry with no bytes left over.
+func Verify(v Vector) error {
+	frame, err := protocol.AppendFrame(nil, v.Wrapper)
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode: %w", v.Name, err)
+	}
+	if !bytes.Equal(frame, v.Frame) {
+		return fmt.Errorf("%s: encoded frame mismatch:\n  want % x\n  got  % x", v.Name, v.Frame, frame)
+	}
+
+	r := bytes.NewReader(v.Frame)
+	dec := protocol.NewDecoder(r, protocol.DefaultRegistry())
+	w, err := dec.Decode()
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode: %w", v.Name, err)
+	}
+	if !reflect.DeepEqual(w, v.Wrapper) {
+		return fmt.Errorf("%s: decoded packet mismatch:\n  want %T %+v\n  got  %T %+v", v.Name, v.Wrapper.P, v.Wrapper.P, w.P, w.P)
+	}
+	if _, err := dec.Decode(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: frame not fully consumed: %v", v.Name, err)
+	}
+	return nil
+}
+
+// Vectors contains a vector of every built-in packet. None has been captured from the Java implementation yet,
+// so all are GoOnly. AuthChallenge (0x0e) and AuthResponse (0x0f) only exist in Go, so their vectors stay GoOnly.
+var Vectors = []Vector{
+	{
+		Name: "handshake",
+		Wrapper: &protocol.Wrapper{P: &protocol.Handshake{Data: types.HandshakeData{
+			ClientName: "lobby",
+			Password:   "pw",
+			Software:   types.SoftwarePM5,
+			Protocol:   2,
+		}}},
+		Frame: []byte{
+			0x0a, 0x20, // magic
+			0x00, 0x00, 0x00, 0x19, // payload length: 25
+			0x01,                   // packet ID
+			0x00,                   // response flag
+			0x00, 0x00, 0x00, 0x01, // Software
+			0x00, 0x00, 0x00, 0x05, 'l', 'o', 'b', 'b', 'y', // ClientName
+			0x00, 0x00, 0x00, 0x02, 'p', 'w', // Password
+			0x00, 0x00, 0x00, 0x02, // Protocol
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "server_handshake",
+		Wrapper: &protocol.Wrapper{P: &protocol.ServerHandshake{Success: true}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x03,
+			0x02,
+			0x00,
+			0x01, // Success
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "disconnect",
+		Wrapper: &protocol.Wrapper{P: &protocol.Disconnect{Reason: "bye"}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x09,
+			0x03,
+			0x00,
+			0x00, 0x00, 0x00, 0x03, 'b', 'y', 'e', // Reason
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "ping",
+		Wrapper: &protocol.Wrapper{P: &protocol.Ping{PingTime: 1700000000000}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0a,
+			0x04,
+			0x00,
+			0x00, 0x00, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, // PingTime
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "pong",
+		Wrapper: &protocol.Wrapper{P: &protocol.Pong{PingTime: 1700000000000}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0a,
+			0x05,
+			0x00,
+			0x00, 0x00, 0x01, 0x8b, 0xcf, 0xe5, 0x68, 0x00, // PingTime
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "reconnect",
+		Wrapper: &protocol.Wrapper{P: &protocol.Reconnect{Reason: "restart"}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0d,
+			0x06,
+			0x00,
+			0x00, 0x00, 0x00, 0x07, 'r', 'e', 's', 't', 'a', 'r', 't', // Reason
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "forward",
+		Wrapper: &protocol.Wrapper{P: &protocol.Forward{
+			ClientName: "b",
+			// A Disconnect with an empty reason.
+			Payload: []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00},
+		}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x11,
+			0x07,
+			0x00,
+			0x00, 0x00, 0x00, 0x01, 'b', // ClientName
+			0x00, 0x00, 0x00, 0x06, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, // Payload
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "server_info_request",
+		Wrapper: &protocol.Wrapper{
+			P:          &protocol.ServerInfoRequest{ServerName: "", SelfInfo: true},
+			Response:   true,
+			ResponseID: 1,
+		},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0b,
+			0x08,
+			0x01,                   // response flag
+			0x00, 0x00, 0x00, 0x01, // response ID
+			0x00, 0x00, 0x00, 0x00, // ServerName
+			0x01, // SelfInfo
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "server_info_response",
+		Wrapper: &protocol.Wrapper{
+			P: &protocol.ServerInfoResponse{
+				ServerName:    "",
+				SelfInfo:      true,
+				OnlinePlayers: 3,
+				MaxPlayers:    100,
+				PlayerList:    []string{"Steve"},
+				ServerList:    []string{"lobby"},
+			},
+			Response:   true,
+			ResponseID: 1,
+		},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x2d,
+			0x09,
+			0x01,
+			0x00, 0x00, 0x00, 0x01,
+			0x00, 0x00, 0x00, 0x00, // ServerName
+			0x01,                   // SelfInfo
+			0x00, 0x00, 0x00, 0x03, // OnlinePlayers
+			0x00, 0x00, 0x00, 0x64, // MaxPlayers
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 'S', 't', 'e', 'v', 'e', // PlayerList
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 'l', 'o', 'b', 'b', 'y', // ServerList
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "server_transfer",
+		Wrapper: &protocol.Wrapper{P: &protocol.ServerTransfer{PlayerName: "Steve", TargetServer: "game-1"}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x15,
+			0x0a,
+			0x00,
+			0x00, 0x00, 0x00, 0x05, 'S', 't', 'e', 'v', 'e', // PlayerName
+			0x00, 0x00, 0x00, 0x06, 'g', 'a', 'm', 'e', '-', '1', // TargetServer
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "player_ping_request",
+		Wrapper: &protocol.Wrapper{
+			P:          &protocol.PlayerPingRequest{PlayerName: "Steve"},
+			Response:   true,
+			ResponseID: 2,
+		},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0f,
+			0x0b,
+			0x01,
+			0x00, 0x00, 0x00, 0x02,
+			0x00, 0x00, 0x00, 0x05, 'S', 't', 'e', 'v', 'e', // PlayerName
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "player_ping_response",
+		Wrapper: &protocol.Wrapper{
+			P:          &protocol.PlayerPingResponse{PlayerName: "Steve", UpstreamPing: 12, DownstreamPing: 34},
+			Response:   true,
+			ResponseID: 2,
+		},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x1f,
+			0x0c,
+			0x01,
+			0x00, 0x00, 0x00, 0x02,
+			0x00, 0x00, 0x00, 0x05, 'S', 't', 'e', 'v', 'e', // PlayerName
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, // UpstreamPing
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x22, // DownstreamPing
+		},
+		GoOnly: true,
+	},
+	{
+		Name: "server_manage",
+		Wrapper: &protocol.Wrapper{P: &protocol.ServerManage{
+			Action:        protocol.ServerManageActionAdd,
+			ServerName:    "game-1",
+			ServerAddress: "127.0.0.1",
+			ServerPort:    19132,
+			ServerType:    "game",
+		}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x26,
+			0x0d,
+			0x00,
+			0x00,                                                 // Action
+			0x00, 0x00, 0x00, 0x06, 'g', 'a', 'm', 'e', '-', '1', // ServerName
+			0x00, 0x00, 0x00, 0x09, '1', '2', '7', '.', '0', '.', '0', '.', '1', // ServerAddress
+			0x00, 0x00, 0x4a, 0xbc, // ServerPort
+			0x00, 0x00, 0x00, 0x04, 'g', 'a', 'm', 'e', // ServerType
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "auth_challenge",
+		Wrapper: &protocol.Wrapper{P: &protocol.AuthChallenge{Nonce: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0a,
+			0x0e,
+			0x00,
+			0x00, 0x00, 0x00, 0x04, 0xde, 0xad, 0xbe, 0xef, // Nonce
+		},
+		GoOnly: true,
+	},
+	{
+		Name:    "auth_response",
+		Wrapper: &protocol.Wrapper{P: &protocol.AuthResponse{Proof: []byte{0x01, 0x02, 0x03, 0x04}}},
+		Frame: []byte{
+			0x0a, 0x20,
+			0x00, 0x00, 0x00, 0x0a,
+			0x0f,
+			0x00,
+			0x00, 0x00, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04, // Proof
+		},
+		GoOnly: true,
+	},
+}
@@ -0,0 +1,109 @@
+package golden_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/golden"
+)
+
+// readCaptures reads the frames captured from the Java implementation in testdata/captured.txt, keyed by vector name.
+func readCaptures(t *testing.T) map[string][]byte {
+	t.Helper()
+	f, err := os.Open("testdata/captured.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	captures := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hexFrame, ok := strings.Cut(text, " ")
+		if !ok {
+			t.Fatalf("captured.txt:%d: expected name and hex", line)
+		}
+		frame, err := hex.DecodeString(strings.TrimSpace(hexFrame))
+		if err != nil {
+			t.Fatalf("captured.txt:%d: %v", line, err)
+		}
+		if _, ok := captures[name]; ok {
+			t.Fatalf("captured.txt:%d: duplicate capture of %s", line, name)
+		}
+		captures[name] = frame
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return captures
+}
+
+func TestVectors(t *testing.T) {
+	captures := readCaptures(t)
+	for _, v := range golden.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			if err := golden.Verify(v); err != nil {
+				t.Fatal(err)
+			}
+			captured, ok := captures[v.Name]
+			delete(captures, v.Name)
+			switch {
+			case v.GoOnly && ok:
+				t.Errorf("vector is labelled GoOnly but has a capture")
+			case !v.GoOnly && !ok:
+				t.Errorf("vector has no capture, label it GoOnly")
+			case ok && !bytes.Equal(v.Frame, captured):
+				t.Errorf("frame differs from the capture:\n  want % x\n  got  % x", captured, v.Frame)
+			}
+		})
+	}
+	for name := range captures {
+		t.Errorf("capture %s has no vector", name)
+	}
+}
+
+// goOnlyPackets contains the vectors of packets that only exist in Go, which can never be captured from Java.
+var goOnlyPackets = map[string]bool{"auth_challenge": true, "auth_response": true}
+
+func TestVectorsCapturedFromJava(t *testing.T) {
+	for _, v := range golden.Vectors {
+		if goOnlyPackets[v.Name] {
+			continue
+		}
+		t.Run(v.Name, func(t *testing.T) {
+			if v.GoOnly {
+				t.Skip("not captured from the Java implementation, compatibility is unverified")
+			}
+		})
+	}
+}
+
+func TestVectorsCoverBuiltinPackets(t *testing.T) {
+	names := make(map[string]bool)
+	ids := make(map[uint64]golden.Vector)
+	for _, v := range golden.Vectors {
+		if names[v.Name] {
+			t.Errorf("duplicate vector name %s", v.Name)
+		}
+		names[v.Name] = true
+		ids[v.Wrapper.P.ID()] = v
+	}
+	reg := protocol.DefaultRegistry()
+	for id := uint64(1); id <= 0xff; id++ {
+		if _, ok := reg.Lookup(id); !ok {
+			continue
+		}
+		if _, ok := ids[id]; !ok {
+			t.Errorf("no vector of built-in packet 0x%02x", id)
+		}
+	}
+}
@@ -15,4 +15,6 @@ const (
 	IDPlayerPingRequest  = 0x0b
 	IDPlayerPingResponse = 0x0c
 	IDServerManage       = 0x0d
+	IDAuthChallenge      = 0x0e
+	IDAuthResponse       = 0x0f
 )
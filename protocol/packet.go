@@ -2,14 +2,23 @@ package protocol
 
 import "io"
 
-// Pool is a map of packet IDs to a function that returns a new packet of that type.
-var Pool = map[uint64]func() Packet{
-	IDHandshake:       func() Packet { return &Handshake{} },
-	IDServerHandshake: func() Packet { return &ServerHandshake{} },
-	IDDisconnect:      func() Packet { return &Disconnect{} },
-	IDPing:            func() Packet { return &Ping{} },
-	IDPong:            func() Packet { return &Pong{} },
-	IDServerTransfer:  func() Packet { return &ServerTransfer{} },
+// builtinPackets is a map of IDs of the built-in packets to a function that returns a new packet of that type.
+var builtinPackets = map[uint64]func() Packet{
+	IDHandshake:          func() Packet { return &Handshake{} },
+	IDServerHandshake:    func() Packet { return &ServerHandshake{} },
+	IDDisconnect:         func() Packet { return &Disconnect{} },
+	IDPing:               func() Packet { return &Ping{} },
+	IDPong:               func() Packet { return &Pong{} },
+	IDReconnect:          func() Packet { return &Reconnect{} },
+	IDForward:            func() Packet { return &Forward{} },
+	IDServerInfoRequest:  func() Packet { return &ServerInfoRequest{} },
+	IDServerInfoResponse: func() Packet { return &ServerInfoResponse{} },
+	IDServerTransfer:     func() Packet { return &ServerTransfer{} },
+	IDPlayerPingRequest:  func() Packet { return &PlayerPingRequest{} },
+	IDPlayerPingResponse: func() Packet { return &PlayerPingResponse{} },
+	IDServerManage:       func() Packet { return &ServerManage{} },
+	IDAuthChallenge:      func() Packet { return &AuthChallenge{} },
+	IDAuthResponse:       func() Packet { return &AuthResponse{} },
 }
 
 // Packet is a interface that can read and write packet data.
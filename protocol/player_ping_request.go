@@ -0,0 +1,27 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// PlayerPingRequest is a packet to request the latency of given player.
+type PlayerPingRequest struct {
+	// PlayerName is the name of player.
+	PlayerName string
+}
+
+func (p *PlayerPingRequest) Read(r io.Reader) error {
+	var err error
+	p.PlayerName, err = util.ReadString(r)
+	return err
+}
+
+func (p *PlayerPingRequest) Write(w io.Writer) error {
+	return util.WriteString(w, p.PlayerName)
+}
+
+func (*PlayerPingRequest) ID() uint64 {
+	return IDPlayerPingRequest
+}
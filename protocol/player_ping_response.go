@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// PlayerPingResponse is a packet sent in response to PlayerPingRequest.
+type PlayerPingResponse struct {
+	// PlayerName is the name of player.
+	PlayerName string
+	// UpstreamPing is the latency between the player and the proxy in milliseconds.
+	UpstreamPing int64
+	// DownstreamPing is the latency between the proxy and the server in milliseconds.
+	DownstreamPing int64
+}
+
+func (p *PlayerPingResponse) Read(r io.Reader) error {
+	var err error
+
+	p.PlayerName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.UpstreamPing, err = util.ReadInt64(r)
+	if err != nil {
+		return err
+	}
+
+	p.DownstreamPing, err = util.ReadInt64(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PlayerPingResponse) Write(w io.Writer) error {
+	if err := util.WriteString(w, p.PlayerName); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt64(w, p.UpstreamPing); err != nil {
+		return err
+	}
+
+	return util.WriteInt64(w, p.DownstreamPing)
+}
+
+func (*PlayerPingResponse) ID() uint64 {
+	return IDPlayerPingResponse
+}
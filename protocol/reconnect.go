@@ -0,0 +1,30 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// Reconnect is a packet that asks the client to drop the connection and dial the server again.
+type Reconnect struct {
+	// Reason is the reason why the client should reconnect.
+	Reason string
+}
+
+func (p *Reconnect) Read(r io.Reader) error {
+	reason, err := util.ReadString(r)
+	if err != nil {
+		return err
+	}
+	p.Reason = reason
+	return nil
+}
+
+func (p *Reconnect) Write(w io.Writer) error {
+	return util.WriteString(w, p.Reason)
+}
+
+func (*Reconnect) ID() uint64 {
+	return IDReconnect
+}
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+var (
+	// ErrPacketRegistered is returned when registering a packet ID that is already registered.
+	ErrPacketRegistered = errors.New("packet ID already registered")
+	// ErrInvalidPacketID is returned when registering a packet ID that cannot be sent on the wire.
+	ErrInvalidPacketID = errors.New("invalid packet ID")
+)
+
+// Registry is a set of packets that can be decoded, keyed by packet ID, along with the limits applied
+// to the lengths read while decoding them.
+// It is safe for concurrent use, so packets may be registered while connections are reading.
+type Registry struct {
+	mu      sync.RWMutex
+	packets map[uint64]func() Packet
+	limits  util.Limits
+}
+
+// NewRegistry returns a new Registry with no packets.
+func NewRegistry() *Registry {
+	return &Registry{packets: make(map[uint64]func() Packet)}
+}
+
+// DefaultRegistry returns a new Registry containing the built-in packets.
+// Each call returns a different Registry, so that packets registered to one do not affect the others.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for id, f := range builtinPackets {
+		r.packets[id] = f
+	}
+	return r
+}
+
+// Register registers the function that returns a new packet of the given ID.
+// It returns ErrPacketRegistered if the ID is already registered, or ErrInvalidPacketID if the ID
+// is IDUnknown or does not fit in a byte.
+func (r *Registry) Register(id uint64, f func() Packet) error {
+	if id == IDUnknown || id > 0xff {
+		return fmt.Errorf("%w: %d", ErrInvalidPacketID, id)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.packets[id]; ok {
+		return fmt.Errorf("%w: %d", ErrPacketRegistered, id)
+	}
+	r.packets[id] = f
+	return nil
+}
+
+// Lookup returns the function that returns a new packet of the given ID.
+func (r *Registry) Lookup(id uint64) (func() Packet, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.packets[id]
+	return f, ok
+}
+
+// SetLimits sets the limits applied by DecodePayload to the lengths of strings and arrays read by the packets.
+// Zero fields use the defaults of util.Limits.
+func (r *Registry) SetLimits(l util.Limits) {
+	r.mu.Lock()
+	r.limits = l
+	r.mu.Unlock()
+}
+
+// Limits returns the limits set by SetLimits.
+func (r *Registry) Limits() util.Limits {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.limits
+}
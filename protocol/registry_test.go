@@ -0,0 +1,52 @@
+package protocol_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+func TestRegistryLimits(t *testing.T) {
+	payload, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Disconnect{Reason: strings.Repeat("a", 16)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := protocol.DefaultRegistry()
+	if _, err := protocol.DecodePayload(payload, reg); err != nil {
+		t.Fatalf("default limits: %v", err)
+	}
+	reg.SetLimits(util.Limits{MaxStringLength: 15})
+	if _, err := protocol.DecodePayload(payload, reg); !errors.Is(err, util.ErrLengthExceedsMax) {
+		t.Errorf("got %v, want ErrLengthExceedsMax", err)
+	}
+	// The limits of one registry do not affect the others.
+	if _, err := protocol.DecodePayload(payload, protocol.DefaultRegistry()); err != nil {
+		t.Errorf("other registry: %v", err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	reg := protocol.DefaultRegistry()
+	newPacket := func() protocol.Packet { return &protocol.Unknown{} }
+	if err := reg.Register(protocol.IDPing, newPacket); !errors.Is(err, protocol.ErrPacketRegistered) {
+		t.Errorf("built-in ID: got %v, want ErrPacketRegistered", err)
+	}
+	for _, id := range []uint64{protocol.IDUnknown, 0x100} {
+		if err := reg.Register(id, newPacket); !errors.Is(err, protocol.ErrInvalidPacketID) {
+			t.Errorf("ID %d: got %v, want ErrInvalidPacketID", id, err)
+		}
+	}
+	if err := reg.Register(0x64, newPacket); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.Lookup(0x64); !ok {
+		t.Error("registered packet not found")
+	}
+	if _, ok := protocol.NewRegistry().Lookup(protocol.IDPing); ok {
+		t.Error("NewRegistry contains built-in packets")
+	}
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// ServerInfoRequest is a packet to request the information of a server or the whole proxy.
+type ServerInfoRequest struct {
+	// ServerName is the name of server to query. Empty string queries the whole proxy.
+	ServerName string
+	// SelfInfo indicates whether the client is asking for its own information.
+	SelfInfo bool
+}
+
+func (p *ServerInfoRequest) Read(r io.Reader) error {
+	var err error
+
+	p.ServerName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.SelfInfo, err = util.ReadBool(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *ServerInfoRequest) Write(w io.Writer) error {
+	if err := util.WriteString(w, p.ServerName); err != nil {
+		return err
+	}
+
+	return util.WriteBool(w, p.SelfInfo)
+}
+
+func (*ServerInfoRequest) ID() uint64 {
+	return IDServerInfoRequest
+}
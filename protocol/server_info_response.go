@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+// ServerInfoResponse is a packet sent in response to ServerInfoRequest.
+type ServerInfoResponse struct {
+	// ServerName is the name of queried server. Empty string if the whole proxy was queried.
+	ServerName string
+	// SelfInfo indicates whether this is the information of the requesting client.
+	SelfInfo bool
+	// OnlinePlayers is the count of online players.
+	OnlinePlayers int32
+	// MaxPlayers is the count of max players.
+	MaxPlayers int32
+	// PlayerList contains the names of online players.
+	PlayerList []string
+	// ServerList contains the names of connected servers.
+	ServerList []string
+}
+
+func (p *ServerInfoResponse) Read(r io.Reader) error {
+	var err error
+
+	p.ServerName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.SelfInfo, err = util.ReadBool(r)
+	if err != nil {
+		return err
+	}
+
+	p.OnlinePlayers, err = util.ReadInt32(r)
+	if err != nil {
+		return err
+	}
+
+	p.MaxPlayers, err = util.ReadInt32(r)
+	if err != nil {
+		return err
+	}
+
+	p.PlayerList, err = util.ReadStringArray(r)
+	if err != nil {
+		return err
+	}
+
+	p.ServerList, err = util.ReadStringArray(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *ServerInfoResponse) Write(w io.Writer) error {
+	if err := util.WriteString(w, p.ServerName); err != nil {
+		return err
+	}
+
+	if err := util.WriteBool(w, p.SelfInfo); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt32(w, p.OnlinePlayers); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt32(w, p.MaxPlayers); err != nil {
+		return err
+	}
+
+	if err := util.WriteStringArray(w, p.PlayerList); err != nil {
+		return err
+	}
+
+	return util.WriteStringArray(w, p.ServerList)
+}
+
+func (*ServerInfoResponse) ID() uint64 {
+	return IDServerInfoResponse
+}
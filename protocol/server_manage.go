@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"io"
+
+	"github.com/alvin0319/go-stargate-server/util"
+)
+
+const (
+	// ServerManageActionAdd requests the server to be added to the proxy.
+	ServerManageActionAdd = iota
+	// ServerManageActionRemove requests the server to be removed from the proxy.
+	ServerManageActionRemove
+	// ServerManageActionSuccess is replied when the requested action succeeded.
+	ServerManageActionSuccess
+	// ServerManageActionFailure is replied when the requested action failed.
+	ServerManageActionFailure
+)
+
+// ServerManage is a packet to add or remove a backend server of the proxy at runtime.
+// The server replies with the same packet with Action set to either ServerManageActionSuccess or ServerManageActionFailure.
+type ServerManage struct {
+	// Action is the action to perform. It is one of the constants above.
+	Action byte
+	// ServerName is the name of server.
+	ServerName string
+	// ServerAddress is the address of server. Unused when removing a server.
+	ServerAddress string
+	// ServerPort is the port of server. Unused when removing a server.
+	ServerPort int32
+	// ServerType is the type of server, such as "lobby". Unused when removing a server.
+	ServerType string
+}
+
+func (p *ServerManage) Read(r io.Reader) error {
+	var err error
+
+	p.Action, err = util.ReadByte(r)
+	if err != nil {
+		return err
+	}
+
+	p.ServerName, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.ServerAddress, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	p.ServerPort, err = util.ReadInt32(r)
+	if err != nil {
+		return err
+	}
+
+	p.ServerType, err = util.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *ServerManage) Write(w io.Writer) error {
+	if err := util.WriteByte(w, p.Action); err != nil {
+		return err
+	}
+
+	if err := util.WriteString(w, p.ServerName); err != nil {
+		return err
+	}
+
+	if err := util.WriteString(w, p.ServerAddress); err != nil {
+		return err
+	}
+
+	if err := util.WriteInt32(w, p.ServerPort); err != nil {
+		return err
+	}
+
+	return util.WriteString(w, p.ServerType)
+}
+
+func (*ServerManage) ID() uint64 {
+	return IDServerManage
+}
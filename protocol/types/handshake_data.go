@@ -11,6 +11,11 @@ const (
 	SoftwarePM5
 )
 
+// ProtocolChallengeAuth is the min protocol version that supports challenge-response authentication.
+// It is chosen well above the versions used by StarGate clients so that they are never mistaken for it.
+// A client on this version sends an empty Password and proves its secret in AuthResponse instead.
+const ProtocolChallengeAuth = 100
+
 type HandshakeData struct {
 	// ClientName is the name of this client.
 	// The server will use this client name as the identifier of connection.
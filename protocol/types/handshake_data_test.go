@@ -0,0 +1,47 @@
+package types_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+)
+
+func FuzzHandshakeDataRead(f *testing.F) {
+	for _, d := range []types.HandshakeData{
+		{ClientName: "lobby", Password: "secret", Software: types.SoftwarePM5, Protocol: 1},
+		{ClientName: "lobby", Software: types.SoftwarePM5, Protocol: types.ProtocolChallengeAuth},
+		// Names the server rejects with ErrInvalidClientName.
+		{ClientName: ""},
+		{ClientName: "lobby\x00"},
+		{ClientName: "\xff\xfe"},
+		{ClientName: strings.Repeat("a", 129)},
+	} {
+		var buf bytes.Buffer
+		if err := d.Write(&buf); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	// A client name announcing more bytes than sent.
+	f.Add([]byte{0, 0, 0, 1, 0x7f, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var d types.HandshakeData
+		if err := d.Read(bytes.NewReader(data)); err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := d.Write(&buf); err != nil {
+			t.Fatalf("failed to write read data: %v", err)
+		}
+		var d2 types.HandshakeData
+		if err := d2.Read(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("failed to read written data: %v", err)
+		}
+		if d != d2 {
+			t.Fatalf("got %+v after round trip, want %+v", d2, d)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"slices"
+
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+)
+
+var (
+	// ErrInvalidPassword is returned when the password of client does not match.
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrUnknownClient is returned when the client name is not allowed to connect.
+	ErrUnknownClient = errors.New("unknown client")
+	// ErrCertificateMismatch is returned when the client certificate does not match the client name.
+	ErrCertificateMismatch = errors.New("client certificate does not match client name")
+	// ErrCertificateUnverified is returned when the connection has no client certificate verified against the
+	// ClientCAs of the listener.
+	ErrCertificateUnverified = errors.New("client certificate not verified")
+	// ErrChallengeRequired is returned when the client sent its password while challenge-response is required.
+	ErrChallengeRequired = errors.New("challenge-response authentication required")
+	// ErrChallengeUnsupported is returned when the Authenticator cannot authenticate by challenge-response.
+	ErrChallengeUnsupported = errors.New("challenge-response authentication not supported")
+)
+
+// Authenticator decides whether a client is allowed to connect with the handshake data it sent.
+type Authenticator interface {
+	// Authenticate returns a non-nil error if the client should be denied.
+	Authenticate(c *Conn, data *types.HandshakeData) error
+}
+
+// ChallengeAuthenticator is an Authenticator that can also authenticate clients by challenge-response,
+// in which case the client proves the knowledge of its secret without sending it.
+// Only Secret is called for such clients, so it must also apply the checks Authenticate does besides the password.
+type ChallengeAuthenticator interface {
+	Authenticator
+	// Secret returns the secret the client has to prove the knowledge of,
+	// or a non-nil error if the client should be denied.
+	Secret(c *Conn, data *types.HandshakeData) (string, error)
+}
+
+// PasswordAuthenticator authenticates every client with the same password.
+type PasswordAuthenticator struct {
+	// Password is the password shared by all clients.
+	Password string
+}
+
+func (a PasswordAuthenticator) Authenticate(_ *Conn, data *types.HandshakeData) error {
+	if !equalSecret(data.Password, a.Password) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (a PasswordAuthenticator) Secret(*Conn, *types.HandshakeData) (string, error) {
+	return a.Password, nil
+}
+
+// CredentialAuthenticator authenticates clients with the secret of their own client name.
+type CredentialAuthenticator struct {
+	// Credentials maps client names to their secrets.
+	Credentials map[string]string
+	// FallbackPassword is used for clients missing in Credentials.
+	// If empty, clients missing in Credentials are rejected with ErrUnknownClient.
+	FallbackPassword string
+}
+
+func (a CredentialAuthenticator) Authenticate(c *Conn, data *types.HandshakeData) error {
+	secret, err := a.Secret(c, data)
+	if err != nil {
+		return err
+	}
+	if !equalSecret(data.Password, secret) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (a CredentialAuthenticator) Secret(_ *Conn, data *types.HandshakeData) (string, error) {
+	secret, ok := a.Credentials[data.ClientName]
+	if !ok {
+		if a.FallbackPassword == "" {
+			return "", ErrUnknownClient
+		}
+		secret = a.FallbackPassword
+	}
+	return secret, nil
+}
+
+// CertificateAuthenticator requires the client certificate of a TLS connection to match the client name,
+// either by the subject common name or one of the DNS names, before authenticating with Authenticator.
+// Only certificates verified by the TLS handshake are trusted, so the ClientAuth of the listener must be
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert, otherwise every client is denied.
+type CertificateAuthenticator struct {
+	// Authenticator authenticates the client after the certificate matched. If nil, the certificate is enough.
+	Authenticator Authenticator
+}
+
+func (a CertificateAuthenticator) Authenticate(c *Conn, data *types.HandshakeData) error {
+	if err := verifyCertificate(c, data); err != nil {
+		return err
+	}
+	if a.Authenticator == nil {
+		return nil
+	}
+	return a.Authenticator.Authenticate(c, data)
+}
+
+func (a CertificateAuthenticator) Secret(c *Conn, data *types.HandshakeData) (string, error) {
+	if err := verifyCertificate(c, data); err != nil {
+		return "", err
+	}
+	ca, ok := a.Authenticator.(ChallengeAuthenticator)
+	if !ok {
+		return "", ErrChallengeUnsupported
+	}
+	return ca.Secret(c, data)
+}
+
+// verifyCertificate checks that the verified client certificate of the connection matches the client name.
+// PeerCertificates is not used, as it is also set when the listener does not verify client certificates.
+func verifyCertificate(c *Conn, data *types.HandshakeData) error {
+	tlsConn, ok := c.Conn.(*tls.Conn)
+	if !ok {
+		return ErrCertificateUnverified
+	}
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ErrCertificateUnverified
+	}
+	cert := chains[0][0]
+	if cert.Subject.CommonName != data.ClientName && !slices.Contains(cert.DNSNames, data.ClientName) {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
+
+// equalSecret compares the secrets in constant time.
+func equalSecret(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
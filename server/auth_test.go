@@ -0,0 +1,261 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/client"
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+	"github.com/alvin0319/go-stargate-server/server"
+	"github.com/alvin0319/go-stargate-server/servertest"
+)
+
+func TestCredentialAuthenticator(t *testing.T) {
+	credentials := map[string]string{"lobby": "lobby-secret", "game": "game-secret"}
+	tests := []struct {
+		name     string
+		fallback string
+		data     types.HandshakeData
+		want     error
+	}{
+		{"own secret", "", types.HandshakeData{ClientName: "lobby", Password: "lobby-secret"}, nil},
+		{"secret of another client", "", types.HandshakeData{ClientName: "lobby", Password: "game-secret"}, server.ErrInvalidPassword},
+		{"unknown client", "", types.HandshakeData{ClientName: "hub", Password: "lobby-secret"}, server.ErrUnknownClient},
+		{"unknown client with fallback", "fallback", types.HandshakeData{ClientName: "hub", Password: "fallback"}, nil},
+		{"unknown client with wrong fallback", "fallback", types.HandshakeData{ClientName: "hub", Password: "lobby-secret"}, server.ErrInvalidPassword},
+		{"fallback of known client", "fallback", types.HandshakeData{ClientName: "lobby", Password: "fallback"}, server.ErrInvalidPassword},
+		{"own secret by challenge", "", types.HandshakeData{ClientName: "game", Password: "game-secret", Protocol: types.ProtocolChallengeAuth}, nil},
+		{"unknown client by challenge", "", types.HandshakeData{ClientName: "hub", Password: "game-secret", Protocol: types.ProtocolChallengeAuth}, server.ErrUnknownClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newLifecycleRecorder()
+			srv := newServer(t, server.ListenConfig{
+				Authenticator: server.CredentialAuthenticator{Credentials: credentials, FallbackPassword: tt.fallback},
+				Lifecycle:     recorder,
+			})
+			c, err := srv.Dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			conn := srv.Accept()
+
+			var success bool
+			if tt.data.Protocol >= types.ProtocolChallengeAuth {
+				success = challengeHandshake(t, c, tt.data.ClientName, tt.data.Password).Success
+			} else {
+				success = c.Handshake(tt.data) == nil
+			}
+			if tt.want == nil {
+				if !success || conn.Name != tt.data.ClientName {
+					t.Fatalf("got success %v and name %q, want %s authenticated", success, conn.Name, tt.data.ClientName)
+				}
+				return
+			}
+			if success {
+				t.Fatal("client was authenticated")
+			}
+			if err := recorder.nextAuthFailure(t); !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+			received, err := c.Closed(servertest.DefaultTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The reason is the same for every error, so that valid client names cannot be enumerated.
+			if len(received) == 0 {
+				t.Fatal("denied client received nothing")
+			}
+			if pk, ok := received[len(received)-1].P.(*protocol.Disconnect); !ok || pk.Reason != "Authentication failed" {
+				t.Errorf("last packet is %T %+v, want Disconnect with a fixed reason", received[len(received)-1].P, received[len(received)-1].P)
+			}
+		})
+	}
+}
+
+// testCA is a certificate authority issuing the certificates of a TLS test.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	ca := &testCA{}
+	ca.cert, ca.key = ca.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "StarGate test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return ca
+}
+
+// issue signs the template with the key of the CA, or self-signs it if the CA has no certificate yet.
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template.SerialNumber = big.NewInt(ca.serial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca.cert != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// tlsCertificate issues a certificate from the template, ready to be used in a tls.Config.
+func (ca *testCA) tlsCertificate(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	cert, key := ca.issue(t, template)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// clientCertificate issues a client certificate with the common name and DNS names.
+func (ca *testCA) clientCertificate(t *testing.T, commonName string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+	return ca.tlsCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		DNSNames:    dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// nonChallengeAuthenticator accepts every client, but cannot authenticate by challenge-response.
+type nonChallengeAuthenticator struct{}
+
+func (nonChallengeAuthenticator) Authenticate(*server.Conn, *types.HandshakeData) error {
+	return nil
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.tlsCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "stargate"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	lobbyCert := ca.clientCertificate(t, "lobby")
+	gameCert := ca.clientCertificate(t, "game-cn", "game")
+	// rogueCert has the right name, but is issued by a CA the listener does not trust.
+	rogueCert := newTestCA(t).clientCertificate(t, "lobby")
+
+	tests := []struct {
+		name          string
+		authenticator server.Authenticator
+		// clientAuth is the ClientAuth of the listener, tls.RequireAndVerifyClientCert if zero.
+		clientAuth tls.ClientAuthType
+		cert       *tls.Certificate
+		data       types.HandshakeData
+		// want is the error passed to OnAuthFailed, or nil if the client authenticates.
+		want error
+		// tlsError reports that the TLS handshake itself fails.
+		tlsError bool
+	}{
+		{"common name", nil, 0, &lobbyCert, types.HandshakeData{ClientName: "lobby"}, nil, false},
+		{"DNS name", nil, 0, &gameCert, types.HandshakeData{ClientName: "game"}, nil, false},
+		{"common name mismatch", nil, 0, &lobbyCert, types.HandshakeData{ClientName: "game"}, server.ErrCertificateMismatch, false},
+		{"DNS name mismatch", nil, 0, &gameCert, types.HandshakeData{ClientName: "lobby"}, server.ErrCertificateMismatch, false},
+		{"no certificate", nil, 0, nil, types.HandshakeData{ClientName: "lobby"}, nil, true},
+		{"password", server.PasswordAuthenticator{Password: testPassword}, 0, &lobbyCert, types.HandshakeData{ClientName: "lobby", Password: testPassword}, nil, false},
+		{"wrong password", server.PasswordAuthenticator{Password: testPassword}, 0, &lobbyCert, types.HandshakeData{ClientName: "lobby", Password: "wrong"}, server.ErrInvalidPassword, false},
+		{"challenge", server.PasswordAuthenticator{Password: testPassword}, 0, &lobbyCert, types.HandshakeData{ClientName: "lobby", Password: testPassword, Protocol: types.ProtocolChallengeAuth}, nil, false},
+		{"challenge mismatch", server.PasswordAuthenticator{Password: testPassword}, 0, &lobbyCert, types.HandshakeData{ClientName: "game", Password: testPassword, Protocol: types.ProtocolChallengeAuth}, server.ErrCertificateMismatch, false},
+		{"untrusted certificate", nil, tls.RequireAnyClientCert, &rogueCert, types.HandshakeData{ClientName: "lobby"}, server.ErrCertificateUnverified, false},
+		{"unverified certificate", nil, tls.RequireAnyClientCert, &lobbyCert, types.HandshakeData{ClientName: "lobby"}, server.ErrCertificateUnverified, false},
+		{"verified if given", nil, tls.VerifyClientCertIfGiven, &lobbyCert, types.HandshakeData{ClientName: "lobby"}, nil, false},
+		{"not given", nil, tls.VerifyClientCertIfGiven, nil, types.HandshakeData{ClientName: "lobby"}, server.ErrCertificateUnverified, false},
+		{"challenge unsupported", nonChallengeAuthenticator{}, 0, &lobbyCert, types.HandshakeData{ClientName: "lobby", Password: testPassword, Protocol: types.ProtocolChallengeAuth}, server.ErrChallengeUnsupported, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newLifecycleRecorder()
+			clientAuth := tt.clientAuth
+			if clientAuth == 0 {
+				clientAuth = tls.RequireAndVerifyClientCert
+			}
+			l, err := server.ListenConfig{
+				Authenticator: server.CertificateAuthenticator{Authenticator: tt.authenticator},
+				TLSConfig: &tls.Config{
+					Certificates: []tls.Certificate{serverCert},
+					ClientAuth:   clientAuth,
+					ClientCAs:    ca.pool(),
+				},
+				Lifecycle: recorder,
+			}.Listen("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(l.Close)
+
+			conf := &tls.Config{RootCAs: ca.pool()}
+			if tt.cert != nil {
+				conf.Certificates = []tls.Certificate{*tt.cert}
+			}
+			accepted := make(chan *server.Conn, 1)
+			go func() { accepted <- l.Accept() }()
+			c, err := client.DialTLS(l.Addr().String(), tt.data, conf)
+			if err == nil {
+				defer c.Close()
+			}
+			conn := <-accepted
+
+			switch {
+			case tt.tlsError:
+				if err == nil {
+					t.Fatal("client without certificate was connected")
+				}
+				if info := recorder.nextDisconnect(t); info.Cause != server.DisconnectReadError {
+					t.Errorf("got disconnect cause %d, want DisconnectReadError", info.Cause)
+				}
+			case tt.want == nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if conn.Name != tt.data.ClientName || conn.State() != server.StateConnected {
+					t.Errorf("got state %d and name %q, want connected %s", conn.State(), conn.Name, tt.data.ClientName)
+				}
+			default:
+				if !errors.Is(err, client.ErrHandshakeFailed) {
+					t.Fatalf("got dial error %v, want ErrHandshakeFailed", err)
+				}
+				if err := recorder.nextAuthFailure(t); !errors.Is(err, tt.want) {
+					t.Errorf("got error %v, want %v", err, tt.want)
+				}
+			}
+		})
+	}
+}
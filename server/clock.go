@@ -0,0 +1,17 @@
+package server
+
+import "time"
+
+// Clock is the source of the current time used by a Listener and its connections to decide when to ping
+// clients, when a ping times out and when a reconnecting client expires. Ticks are still driven by real time
+// every TickInterval, so a Clock advanced manually takes effect on the next tick.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the Clock used if ListenConfig.Clock is nil.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -2,12 +2,16 @@ package server
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alvin0319/go-stargate-server/protocol"
@@ -24,10 +28,26 @@ const (
 	PingInterval = 30 * time.Second
 	PingTimeout  = 5 * time.Second
 	TickInterval = 50 * time.Millisecond
+
+	// ReconnectTimeout is the duration the listener waits for a client asked to reconnect.
+	ReconnectTimeout = 30 * time.Second
+	// DefaultWriteTimeout is the write timeout used if ListenConfig.WriteTimeout is zero.
+	DefaultWriteTimeout = 10 * time.Second
 )
 
+// readBacklog is the number of packets read ahead of the tick goroutine, so that the responses sent after them
+// are still matched while a Handler waits for one.
+const readBacklog = 64
+
+// reasonAuthFailed is the reason sent to clients failing to authenticate. It never includes the error,
+// so that a client cannot tell an unknown client name from a wrong password.
+const reasonAuthFailed = "Authentication failed"
+
+// challengeNonceLength is the length of nonce sent in AuthChallenge.
+const challengeNonceLength = 32
+
 const (
-	StarGateMagic = 0x0a20
+	StarGateMagic = protocol.StarGateMagic
 )
 
 // Conn represents the connection of TCP server.
@@ -35,74 +55,115 @@ type Conn struct {
 	net.Conn
 
 	// Name is the name of this client. This will be empty until fully authenticated.
+	// It is unique among the connections of the listener, and may differ from the client name
+	// sent in the handshake if the listener uses DuplicateSuffix.
+	// It is set before the state changes to StateConnected and never changes afterwards.
 	Name string
 
+	// mu guards the fields below up to h.
+	mu sync.Mutex
 	// queuedPackets contains the packets queued in.
 	// This will be sent to the connection on next available tick.
 	queuedPackets []*protocol.Wrapper
+	// maxPacketsPerTick and maxBytesPerTick limit the packets written per tick. Zero means no limit.
+	maxPacketsPerTick int
+	maxBytesPerTick   int
 
-	// state is a state where the current connection is in.
-	state int
+	handshakeData *types.HandshakeData
 
-	closed chan struct{}
+	lastPingTime time.Time
+	lastPongTime time.Time
+	pingPending  bool
 
-	logger *slog.Logger
+	h Handler
+	// middlewares are the middlewares added by Use, and chain is h wrapped with them.
+	middlewares []Middleware
+	chain       Handler
 
-	handshakeData *types.HandshakeData
+	// challenge is the nonce sent in AuthChallenge, if the client is authenticating by challenge-response.
+	// It is only accessed from the tick goroutine.
+	challenge []byte
+
+	// writeMu serializes flushes so that packets are written in the order they were queued.
+	writeMu sync.Mutex
+	// writeTimeout is the max duration of a flush. Zero means no timeout.
+	writeTimeout time.Duration
+
+	// state is a state where the current connection is in.
+	state atomic.Int32
 
-	password string
+	closed    chan struct{}
+	closeOnce sync.Once
+	// closing is set by the first call to disconnect, Reconnect or closeConn, so that only one of them
+	// sends its packet before closing.
+	closing atomic.Bool
+
+	logger atomic.Pointer[slog.Logger]
 
-	lastPingTime    time.Time
-	lastPongTime    time.Time
-	pingPending     bool
 	pingTimeoutChan chan struct{}
 
-	h Handler
+	responseMu       sync.Mutex
+	lastResponseID   uint32
+	pendingResponses map[uint32]pendingResponse
 
 	bufReader *bufio.Reader
+	dec       *protocol.Decoder
 
 	listener *Listener
 }
 
-func newConn(conn net.Conn, password string, listener *Listener) *Conn {
+func newConn(conn net.Conn, listener *Listener) *Conn {
 	logger := slog.Default().With("addr", conn.RemoteAddr())
 
 	c := &Conn{
 		Name:     "",
 		Conn:     conn,
-		state:    StateAuthenticating,
 		listener: listener,
 
+		writeTimeout: listener.writeTimeout,
+
 		queuedPackets: make([]*protocol.Wrapper, 0),
 		closed:        make(chan struct{}),
 
-		logger:   logger,
-		password: password,
-
-		lastPongTime:    time.Now(),
+		lastPongTime:    listener.clock.Now(),
 		pingTimeoutChan: make(chan struct{}, 1),
 
+		pendingResponses: make(map[uint32]pendingResponse),
+
 		bufReader: bufio.NewReader(conn),
 	}
-	c.logger.Info("new connection established", "state", "authenticating")
+	c.dec = protocol.NewDecoder(c.bufReader, listener.registry)
+	c.state.Store(StateAuthenticating)
+	c.logger.Store(logger)
+	c.buildChain()
+	c.log().Info("new connection established", "state", "authenticating")
 	return c
 }
 
+// State returns the state where the current connection is in.
 func (c *Conn) State() int {
-	return c.state
+	return int(c.state.Load())
 }
 
+// log returns the logger of this connection.
+func (c *Conn) log() *slog.Logger {
+	return c.logger.Load()
+}
+
+// QueuePacket queues the packet to be sent on next tick. It is safe for concurrent use.
 func (c *Conn) QueuePacket(w *protocol.Wrapper) {
+	c.mu.Lock()
 	c.queuedPackets = append(c.queuedPackets, w)
+	c.mu.Unlock()
 }
 
 func (c *Conn) tick() {
-	c.logger.Debug("starting tick loop")
+	c.log().Debug("starting tick loop")
 	ticker := time.NewTicker(TickInterval)
 	defer ticker.Stop()
 
-	readChan := make(chan *protocol.Wrapper)
-	errChan := make(chan error)
+	readChan := make(chan *protocol.Wrapper, readBacklog)
+	errChan := make(chan error, 1)
 
 	go c.readLoop(readChan, errChan)
 
@@ -112,316 +173,533 @@ func (c *Conn) tick() {
 			return
 		case <-ticker.C:
 			c.onTick()
-		case wrapper := <-readChan:
-			c.handlePacket(wrapper)
-		case err := <-errChan:
-			if err == io.EOF {
-				c.logger.Info("connection closed")
+		case wrapper, ok := <-readChan:
+			if ok {
+				c.handlePacket(wrapper)
+				continue
+			}
+			// readChan is closed after the packets read before the error were handled.
+			err := <-errChan
+			if errors.Is(err, io.EOF) {
+				c.log().Info("connection closed")
 			} else {
-				c.logger.Warn("failed to read packet", "err", err)
+				c.log().Warn("failed to read packet", "err", err)
 			}
-			c.closeConn()
+			c.closeConn(DisconnectInfo{Cause: DisconnectReadError, Err: err})
 			return
 		case <-c.pingTimeoutChan:
-			c.logger.Warn("ping timeout, closing connection")
-			c.DisconnectAndClose("Ping timeout")
+			c.log().Warn("ping timeout, closing connection")
+			c.disconnect("Ping timeout", DisconnectPingTimeout)
 			return
 		}
 	}
 }
 
 func (c *Conn) readLoop(readChan chan *protocol.Wrapper, errChan chan error) {
-	c.logger.Debug("starting read loop")
+	c.log().Debug("starting read loop")
 
 	peekBytes, err := c.bufReader.Peek(16)
 	if err == nil {
-		c.logger.Debug("first 16 bytes from client", "hex", fmt.Sprintf("% x", peekBytes))
+		c.log().Debug("first 16 bytes from client", "hex", fmt.Sprintf("% x", peekBytes))
 	}
 
 	for {
 		p, err := c.ReadPacket()
 		if err != nil {
-			c.logger.Debug("read error", "err", err)
+			c.log().Debug("read error", "err", err)
 			errChan <- err
+			close(readChan)
+			return
+		}
+		c.log().Debug("packet read", "id", p.P.ID())
+		// Responses are matched here rather than on the tick goroutine, so that a Handler waiting for one
+		// does not block it.
+		if p.Response && c.State() == StateConnected && c.resolveResponse(p) {
+			continue
+		}
+		select {
+		case readChan <- p:
+		case <-c.closed:
 			return
 		}
-		c.logger.Debug("packet read", "id", p.P.ID())
-		readChan <- p
 	}
 }
 
 func (c *Conn) onTick() {
-	if len(c.queuedPackets) > 0 {
-		wrapper := c.queuedPackets[0]
-		c.queuedPackets = c.queuedPackets[1:]
-
-		// Build payload
-		var payloadBuf bytes.Buffer
-
-		payloadBuf.WriteByte(byte(wrapper.P.ID()))
-
-		if wrapper.Response {
-			payloadBuf.WriteByte(1)
-			responseIDBytes := make([]byte, 4)
-			binary.BigEndian.PutUint32(responseIDBytes, uint32(wrapper.ResponseID))
-			payloadBuf.Write(responseIDBytes)
-		} else {
-			payloadBuf.WriteByte(0)
-		}
-
-		if err := wrapper.P.Write(&payloadBuf); err != nil {
-			c.logger.Error("failed to marshal packet", "err", err)
-			c.closeConn()
-			return
-		}
+	c.mu.Lock()
+	maxPackets, maxBytes := c.maxPacketsPerTick, c.maxBytesPerTick
+	c.mu.Unlock()
+	if err := c.flush(maxPackets, maxBytes); err != nil {
+		c.log().Error("failed to write packet", "err", err)
+		c.closeConn(DisconnectInfo{Cause: DisconnectWriteError, Err: err})
+		return
+	}
 
-		var finalBuf bytes.Buffer
+	if c.State() != StateConnected {
+		return
+	}
 
-		// Write magic (2 bytes, big-endian)
-		if err := binary.Write(&finalBuf, binary.BigEndian, uint16(StarGateMagic)); err != nil {
-			c.logger.Error("failed to write magic", "err", err)
-			c.closeConn()
-			return
+	now := c.listener.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pingPending {
+		if now.Sub(c.lastPingTime) >= PingTimeout {
+			select {
+			case c.pingTimeoutChan <- struct{}{}:
+			default:
+			}
 		}
+	} else if now.Sub(c.lastPongTime) >= PingInterval {
+		c.lastPingTime = now
+		c.pingPending = true
+		c.queuedPackets = append(c.queuedPackets, &protocol.Wrapper{
+			P: &protocol.Ping{PingTime: now.UnixMilli()},
+		})
+	}
+}
 
-		// Write length (4 bytes, big-endian)
-		if err := binary.Write(&finalBuf, binary.BigEndian, uint32(payloadBuf.Len())); err != nil {
-			c.logger.Error("failed to write length", "err", err)
-			c.closeConn()
-			return
-		}
+// flush writes the queued packets to the connection with a single write, failing after the write timeout.
+// Zero maxPackets or maxBytes means no limit, and at least one packet is written if any is queued.
+// Packets over the limits are left in the queue for the next tick, and packets that fail to encode are dropped.
+func (c *Conn) flush(maxPackets, maxBytes int) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeQueued(maxPackets, maxBytes)
+}
 
-		// Write payload
-		finalBuf.Write(payloadBuf.Bytes())
+// flushThrough writes the queued packets up to and including w with a single write, regardless of the tick budget.
+// Nothing is written if w was already flushed.
+func (c *Conn) flushThrough(w *protocol.Wrapper) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	i := slices.Index(c.queuedPackets, w)
+	c.mu.Unlock()
+	if i < 0 {
+		return nil
+	}
+	// Packets are only removed from the queue with writeMu held, so w is still at i.
+	return c.writeQueued(i+1, 0)
+}
 
-		if _, err := c.Write(finalBuf.Bytes()); err != nil {
-			c.logger.Error("failed to write packet", "err", err)
-			c.closeConn()
-			return
+// writeQueued writes the queued packets as described in flush. writeMu must be held.
+func (c *Conn) writeQueued(maxPackets, maxBytes int) error {
+	var buf []byte
+
+	c.mu.Lock()
+	// i is the number of queued packets consumed, and n the number of them written.
+	i, n := 0, 0
+	for ; i < len(c.queuedPackets); i++ {
+		if maxPackets > 0 && n >= maxPackets {
+			break
+		}
+		wrapper := c.queuedPackets[i]
+		frameStart := len(buf)
+		next, err := protocol.AppendFrame(buf, wrapper)
+		if err != nil {
+			// A packet that cannot be encoded is dropped, so that it does not close the connection it was queued on.
+			c.log().Error("dropping packet that failed to encode", "id", wrapper.P.ID(), "err", err)
+			continue
+		}
+		if maxBytes > 0 && n > 0 && len(next) > maxBytes {
+			buf = next[:frameStart]
+			break
 		}
+		buf = next
+		n++
 	}
+	c.queuedPackets = c.queuedPackets[i:]
+	c.mu.Unlock()
 
-	if c.state == StateConnected {
-		now := time.Now()
-
-		if c.pingPending {
-			if now.Sub(c.lastPingTime) >= PingTimeout {
-				select {
-				case c.pingTimeoutChan <- struct{}{}:
-				default:
-				}
-			}
-		} else {
-			if now.Sub(c.lastPongTime) >= PingInterval {
-				c.sendPing()
-			}
+	if len(buf) > 0 {
+		// The write deadline uses the system clock, as it is applied by the connection.
+		if c.writeTimeout > 0 {
+			_ = c.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		}
+		if _, err := c.Write(buf); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func (c *Conn) sendPing() {
-	now := time.Now()
-	c.lastPingTime = now
-	c.pingPending = true
-
-	c.QueuePacket(&protocol.Wrapper{
-		P: &protocol.Ping{PingTime: now.UnixMilli()},
-	})
+// SetTickBudget limits the packets and bytes written to the connection per tick.
+// Zero means no limit, which is the default.
+func (c *Conn) SetTickBudget(maxPackets, maxBytes int) {
+	c.mu.Lock()
+	c.maxPacketsPerTick = maxPackets
+	c.maxBytesPerTick = maxBytes
+	c.mu.Unlock()
 }
 
 func (c *Conn) handlePacket(wrapper *protocol.Wrapper) {
-	switch c.state {
+	switch c.State() {
 	case StateAuthenticating:
-		if wrapper.P.ID() == protocol.IDHandshake {
-			handshake := wrapper.P.(*protocol.Handshake)
-			c.handshakeData = &handshake.Data
-			c.logger.Info("received handshake", "client", handshake.Data.ClientName, "software", handshake.Data.Software, "protocol", handshake.Data.Protocol)
-
-			success := handshake.Data.Password == c.password
-			if !success {
-				c.logger.Warn("invalid password", "client", handshake.Data.ClientName)
-			}
-
-			c.QueuePacket(&protocol.Wrapper{
-				P: &protocol.ServerHandshake{Success: success},
-			})
-
-			if success {
-				c.state = StateConnected
-				c.Name = handshake.Data.ClientName
-				c.logger = c.logger.With("conn", handshake.Data.ClientName)
-				c.logger.Info("authenticated")
-			} else {
-				go func() {
-					time.Sleep(100 * time.Millisecond)
-					c.DisconnectAndClose("Invalid password")
-				}()
-			}
-		} else {
-			c.logger.Warn("unexpected packet during authentication", "packetID", wrapper.P.ID(), "expected", protocol.IDHandshake)
+		switch pk := wrapper.P.(type) {
+		case *protocol.Handshake:
+			c.handleHandshake(pk)
+		case *protocol.AuthResponse:
+			c.handleAuthResponse(pk)
+		default:
+			c.log().Warn("unexpected packet during authentication", "packetID", wrapper.P.ID(), "expected", protocol.IDHandshake)
 		}
 	case StateConnected:
-		if c.h != nil {
-			if err := c.h.Handle(wrapper); err != nil {
-				c.logger.Error("failed to handle packet", "err", err)
+		c.mu.Lock()
+		h := c.chain
+		c.mu.Unlock()
+		if h != nil {
+			if err := h.Handle(wrapper); err != nil {
+				c.log().Error("failed to handle packet", "err", err)
 			}
 		}
-		switch wrapper.P.ID() {
-		case protocol.IDDisconnect:
-			disconnect := wrapper.P.(*protocol.Disconnect)
-			c.logger.Info("disconnected", "reason", disconnect.Reason)
-			c.closeConn()
-		case protocol.IDPing:
-			ping := wrapper.P.(*protocol.Ping)
+		// Packets are matched by type rather than ID, as a custom Registry may decode
+		// a built-in ID to a different packet.
+		switch pk := wrapper.P.(type) {
+		case *protocol.Disconnect:
+			c.log().Info("disconnected", "reason", pk.Reason)
+			c.closeConn(DisconnectInfo{Cause: DisconnectClient, Reason: pk.Reason})
+		case *protocol.Ping:
 			c.QueuePacket(&protocol.Wrapper{
-				P: &protocol.Pong{PingTime: ping.PingTime},
+				P: &protocol.Pong{PingTime: pk.PingTime},
 			})
-		case protocol.IDPong:
+		case *protocol.Pong:
+			c.mu.Lock()
 			c.pingPending = false
-			c.lastPongTime = time.Now()
-			c.logger.Debug("received pong from client", "pingTime", wrapper.P.(*protocol.Pong).PingTime, "latency", time.Since(time.UnixMilli(wrapper.P.(*protocol.Pong).PingTime)))
-		case protocol.IDUnknown:
-			unknown := wrapper.P.(*protocol.Unknown)
-			c.logger.Warn("received unknown packet", "id", unknown.PacketID)
+			c.lastPongTime = c.listener.clock.Now()
+			c.mu.Unlock()
+			c.log().Debug("received pong from client", "pingTime", pk.PingTime, "latency", c.listener.clock.Now().Sub(time.UnixMilli(pk.PingTime)))
+		case *protocol.Forward:
+			c.handleForward(wrapper, pk)
+		case *protocol.ServerInfoRequest:
+			c.handleServerInfoRequest(wrapper, pk)
+		case *protocol.ServerManage:
+			c.handleServerManage(wrapper, pk)
+		case *protocol.Unknown:
+			c.log().Warn("received unknown packet", "id", pk.PacketID)
 		}
 	}
 }
 
-// DisconnectAndClose sends a disconnect packet with the given reason and closes the connection.
-func (c *Conn) DisconnectAndClose(reason string) {
-	// Only disconnect if not already closed
-	select {
-	case <-c.closed:
+// handleHandshake authenticates the client with the handshake data,
+// or sends an AuthChallenge if the client requested challenge-response authentication.
+func (c *Conn) handleHandshake(handshake *protocol.Handshake) {
+	if c.HandshakeData() != nil {
+		c.log().Warn("duplicate handshake", "client", handshake.Data.ClientName)
+		return
+	}
+	c.mu.Lock()
+	c.handshakeData = &handshake.Data
+	c.mu.Unlock()
+	c.log().Info("received handshake", "client", handshake.Data.ClientName, "software", handshake.Data.Software, "protocol", handshake.Data.Protocol)
+
+	if !validClientName(handshake.Data.ClientName) {
+		c.finishAuth(&handshake.Data, ErrInvalidClientName)
+		return
+	}
+
+	if handshake.Data.Protocol >= types.ProtocolChallengeAuth && handshake.Data.Password == "" {
+		nonce := make([]byte, challengeNonceLength)
+		if _, err := rand.Read(nonce); err != nil {
+			c.finishAuth(&handshake.Data, err)
+			return
+		}
+		c.challenge = nonce
+		c.QueuePacket(&protocol.Wrapper{
+			P: &protocol.AuthChallenge{Nonce: nonce},
+		})
+		return
+	}
+	if c.listener.requireChallenge {
+		c.finishAuth(&handshake.Data, ErrChallengeRequired)
+		return
+	}
+	c.finishAuth(&handshake.Data, c.listener.authenticate(c, &handshake.Data))
+}
+
+// handleAuthResponse verifies the proof sent in response to AuthChallenge.
+func (c *Conn) handleAuthResponse(resp *protocol.AuthResponse) {
+	data := c.HandshakeData()
+	if data == nil || c.challenge == nil {
+		c.log().Warn("unexpected auth response")
 		return
-	default:
 	}
+	nonce := c.challenge
+	c.challenge = nil
 
-	c.logger.Info("disconnecting", "reason", reason)
+	secret, err := c.listener.secret(c, data)
+	if err == nil && !hmac.Equal(resp.Proof, protocol.ChallengeProof(secret, nonce, data.ClientName)) {
+		err = ErrInvalidPassword
+	}
+	c.finishAuth(data, err)
+}
+
+// finishAuth replies the result of authentication, and either marks the connection as connected
+// or disconnects it shortly after.
+func (c *Conn) finishAuth(data *types.HandshakeData, err error) {
+	var reconnected bool
+	if err == nil {
+		reconnected, err = c.listener.claimName(c, data.ClientName)
+		if errors.Is(err, ErrConnClosed) {
+			// The connection was closed during authentication, so there is nobody to reply to.
+			return
+		}
+	}
+	success := err == nil
+	if !success {
+		c.log().Warn("authentication failed", "client", data.ClientName, "err", err)
+	}
 
-	// Queue disconnect packet
 	c.QueuePacket(&protocol.Wrapper{
-		P: &protocol.Disconnect{
-			Reason: reason,
-		},
-		Response: false,
+		P: &protocol.ServerHandshake{Success: success},
 	})
 
-	// Flush all queued packets (including the disconnect packet)
-	for len(c.queuedPackets) > 0 {
-		c.onTick()
+	if !success {
+		for _, h := range c.lifecycleHandlers() {
+			h.OnAuthFailed(c, err)
+		}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			c.disconnect(reasonAuthFailed, DisconnectAuthFailed)
+		}()
+		return
 	}
 
-	// Now close the connection
-	c.closeConn()
+	c.logger.Store(c.log().With("conn", c.Name))
+	if !c.state.CompareAndSwap(StateAuthenticating, StateConnected) {
+		return
+	}
+	c.log().Info("authenticated")
+	if reconnected {
+		c.log().Info("client reconnected")
+	}
+	for _, h := range c.lifecycleHandlers() {
+		h.OnStateChange(c, StateAuthenticating, StateConnected)
+		h.OnAuthenticated(c)
+	}
 }
 
-func (c *Conn) closeConn() {
-	select {
-	case <-c.closed:
+// handleServerInfoRequest answers the ServerInfoRequest using the InfoProvider of the listener.
+// If the InfoProvider fails, an empty ServerInfoResponse is replied so that the client does not wait for it.
+func (c *Conn) handleServerInfoRequest(wrapper *protocol.Wrapper, req *protocol.ServerInfoRequest) {
+	if c.listener == nil {
 		return
-	default:
-		close(c.closed)
 	}
+	resp, err := c.listener.serverInfo(c, req)
+	if err != nil {
+		c.log().Warn("failed to provide server info", "server", req.ServerName, "err", err)
+		resp = &protocol.ServerInfoResponse{}
+	}
+	c.QueuePacket(&protocol.Wrapper{
+		P:          resp,
+		Response:   wrapper.Response,
+		ResponseID: wrapper.ResponseID,
+	})
+}
 
-	c.state = StateDisconnected
-	c.logger.Info("closing connection")
+// handleServerManage applies the ServerManage packet using the ServerManager of the listener and replies the result.
+// An unknown action is replied with ServerManageActionFailure without reaching the ServerManager.
+func (c *Conn) handleServerManage(wrapper *protocol.Wrapper, manage *protocol.ServerManage) {
+	if c.listener == nil {
+		return
+	}
 
-	// Remove from listener's connection tracking
-	if c.listener != nil {
-		c.listener.removeConnection(c)
+	result := byte(protocol.ServerManageActionSuccess)
+	if manage.Action != protocol.ServerManageActionAdd && manage.Action != protocol.ServerManageActionRemove {
+		c.log().Warn("unexpected server manage action", "action", manage.Action, "server", manage.ServerName)
+		result = protocol.ServerManageActionFailure
+	} else if err := c.listener.manageServer(c, manage); err != nil {
+		c.log().Warn("failed to manage server", "action", manage.Action, "server", manage.ServerName, "err", err)
+		result = protocol.ServerManageActionFailure
+	} else {
+		c.log().Info("managed server", "action", manage.Action, "server", manage.ServerName, "address", manage.ServerAddress, "port", manage.ServerPort)
 	}
 
-	c.Conn.Close()
+	c.QueuePacket(&protocol.Wrapper{
+		P: &protocol.ServerManage{
+			Action:        result,
+			ServerName:    manage.ServerName,
+			ServerAddress: manage.ServerAddress,
+			ServerPort:    manage.ServerPort,
+			ServerType:    manage.ServerType,
+		},
+		Response:   wrapper.Response,
+		ResponseID: wrapper.ResponseID,
+	})
 }
 
-func (c *Conn) HandshakeData() *types.HandshakeData {
-	return c.handshakeData
+// DisconnectAndClose sends a disconnect packet with the given reason and closes the connection.
+func (c *Conn) DisconnectAndClose(reason string) {
+	c.disconnect(reason, DisconnectServer)
 }
 
-// ReadPacket reads a single packet from the connection.
-func (c *Conn) ReadPacket() (*protocol.Wrapper, error) {
-	// Read magic (2 bytes, big-endian)
-	var magic uint16
-	if err := binary.Read(c.bufReader, binary.BigEndian, &magic); err != nil {
-		return nil, fmt.Errorf("failed to read magic: %w", err)
-	}
-	if magic != StarGateMagic {
-		return nil, fmt.Errorf("invalid magic: expected 0x%04x, got 0x%04x", StarGateMagic, magic)
+// disconnect sends a disconnect packet with the given reason and closes the connection with the cause.
+func (c *Conn) disconnect(reason string, cause DisconnectCause) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return
 	}
-	c.logger.Debug("read magic", "magic", fmt.Sprintf("0x%04x", magic))
 
-	// Read length (4 bytes, big-endian)
-	var length uint32
-	if err := binary.Read(c.bufReader, binary.BigEndian, &length); err != nil {
-		return nil, fmt.Errorf("failed to read length: %w", err)
+	c.log().Info("disconnecting", "reason", reason)
+
+	c.flushAndClose(&protocol.Disconnect{
+		Reason: reason,
+	}, DisconnectInfo{Cause: cause, Reason: reason})
+}
+
+// Reconnect asks the client to reconnect with the given reason and closes the connection.
+// The listener accepts the returning client under the same name within ReconnectTimeout.
+// A client whose name was suffixed by DuplicateSuffix returns under the name of its handshake, which is held by
+// another client, so it is not expected back: it is accepted as a new client and given a suffix again.
+func (c *Conn) Reconnect(reason string) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return
 	}
-	c.logger.Debug("read payload length", "length", length)
 
-	if length == 0 || length > 1024*1024 {
-		return nil, fmt.Errorf("invalid payload length: %d", length)
+	c.log().Info("reconnecting", "reason", reason)
+
+	if c.listener != nil && c.State() == StateConnected && c.Name == c.HandshakeData().ClientName {
+		c.listener.expectReconnect(c.Name)
 	}
 
-	// Read payload
-	payloadData := make([]byte, length)
-	if _, err := io.ReadFull(c.bufReader, payloadData); err != nil {
-		return nil, fmt.Errorf("failed to read payload: %w", err)
+	c.flushAndClose(&protocol.Reconnect{
+		Reason: reason,
+	}, DisconnectInfo{Cause: DisconnectReconnect, Reason: reason})
+}
+
+// flushAndClose queues the packet, flushes all queued packets and closes the connection.
+func (c *Conn) flushAndClose(p protocol.Packet, info DisconnectInfo) {
+	c.QueuePacket(&protocol.Wrapper{
+		P:        p,
+		Response: false,
+	})
+
+	// Flush all queued packets (including the given packet)
+	if err := c.flush(0, 0); err != nil {
+		c.log().Debug("failed to flush packets before closing", "err", err)
 	}
-	c.logger.Debug("full payload", "hex", fmt.Sprintf("% x", payloadData))
 
-	// Parse payload
-	payloadBuf := bytes.NewReader(payloadData)
+	// Now close the connection
+	c.closeConn(info)
+}
+
+func (c *Conn) closeConn(info DisconnectInfo) {
+	c.closeOnce.Do(func() {
+		c.closing.Store(true)
+		close(c.closed)
+
+		from := int(c.state.Swap(StateDisconnected))
+		c.log().Info("closing connection")
+		c.clearResponses()
+
+		// Remove from listener's connection tracking
+		if c.listener != nil {
+			c.listener.removeConnection(c)
+		}
+
+		c.Conn.Close()
+
+		for _, h := range c.lifecycleHandlers() {
+			h.OnStateChange(c, from, StateDisconnected)
+			h.OnDisconnect(c, info)
+		}
+	})
+}
+
+func (c *Conn) HandshakeData() *types.HandshakeData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handshakeData
+}
 
-	packetID, err := payloadBuf.ReadByte()
+// ReadPacket reads a single packet from the connection.
+func (c *Conn) ReadPacket() (*protocol.Wrapper, error) {
+	payload, err := c.dec.ReadFrame()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read packet ID: %w", err)
+		return nil, err
 	}
-	c.logger.Debug("read raw packet ID", "packetID", packetID, "hex", fmt.Sprintf("0x%02x", packetID))
+	c.log().Debug("full payload", "hex", fmt.Sprintf("% x", payload))
+
+	return c.decodePayload(payload)
+}
 
-	responseByte, err := payloadBuf.ReadByte()
+// decodePayload decodes the payload of a single frame, starting from the packet ID byte.
+func (c *Conn) decodePayload(payload []byte) (*protocol.Wrapper, error) {
+	wrapper, err := protocol.DecodePayload(payload, c.listener.registry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response flag: %w", err)
+		return nil, err
 	}
-	c.logger.Debug("read response byte", "responseByte", responseByte, "isResponse", responseByte != 0)
-
-	wrapper := &protocol.Wrapper{
-		Response: responseByte != 0,
+	c.log().Debug("decoded packet", "packetID", payload[0], "response", wrapper.Response, "responseID", wrapper.ResponseID)
+	if unknown, ok := wrapper.P.(*protocol.Unknown); ok {
+		c.log().Warn("unknown packet ID in registry", "packetID", unknown.PacketID)
+		c.log().Debug("unknown packet payload", "payloadLen", len(unknown.Payload), "payload", fmt.Sprintf("%x", unknown.Payload))
 	}
+	return wrapper, nil
+}
 
-	if wrapper.Response {
-		responseIDBytes := make([]byte, 4)
-		if _, err := io.ReadFull(payloadBuf, responseIDBytes); err != nil {
-			return nil, fmt.Errorf("failed to read response ID: %w", err)
-		}
-		wrapper.ResponseID = uint(binary.BigEndian.Uint32(responseIDBytes))
-		c.logger.Debug("read response ID", "responseID", wrapper.ResponseID)
+// handleForward delivers the packet encoded in the Forward to the target client, in a Forward carrying the name
+// of the sender. If the packet cannot be delivered, the sender is told with an empty Forward as described in protocol.Forward.
+// Packets the server uses to control connections are not delivered, so that a client cannot impersonate the server
+// to another client, and neither is a Forward nested in the payload, so that it cannot be used to relay packets.
+func (c *Conn) handleForward(wrapper *protocol.Wrapper, forward *protocol.Forward) {
+	target, ok := c.listener.Conn(forward.ClientName)
+	if !ok {
+		c.log().Warn("forward target is not connected", "target", forward.ClientName)
+		c.rejectForward(wrapper, forward)
+		return
 	}
 
-	constructor, ok := protocol.Pool[uint64(packetID)]
-	if !ok {
-		c.logger.Warn("unknown packet ID in pool", "packetID", packetID)
-		unknownPacket := &protocol.Unknown{PacketID: uint64(packetID)}
-		if err := unknownPacket.Read(payloadBuf); err != nil {
-			return nil, fmt.Errorf("failed to read unknown packet: %w", err)
-		}
-		c.logger.Debug("unknown packet payload", "payloadLen", len(unknownPacket.Payload), "payload", fmt.Sprintf("%x", unknownPacket.Payload))
-		return &protocol.Wrapper{
-			P:          unknownPacket,
-			Response:   wrapper.Response,
-			ResponseID: wrapper.ResponseID,
-		}, nil
+	if _, err := c.decodePayload(forward.Payload); err != nil {
+		c.log().Warn("failed to decode forwarded packet", "target", forward.ClientName, "err", err)
+		c.rejectForward(wrapper, forward)
+		return
 	}
+	// The target decodes the payload by its ID, whatever packet the ID is registered to.
+	id := uint64(forward.Payload[0])
+	if !forwardable(id) {
+		c.log().Warn("dropping forwarded control packet", "target", forward.ClientName, "id", id)
+		c.rejectForward(wrapper, forward)
+		return
+	}
+	// The response flag of the Forward is not passed on, so that the target cannot mistake the delivery
+	// for the response to one of its own requests.
+	delivered := &protocol.Wrapper{
+		P: &protocol.Forward{ClientName: c.Name, Payload: forward.Payload},
+	}
+	// The name of the sender may be longer than the name of the target, so the delivered frame may exceed
+	// the max payload length even though the Forward received did not.
+	if payload, err := protocol.EncodePayload(delivered); err != nil || len(payload) > protocol.MaxPayloadLength {
+		c.log().Warn("forwarded packet is too large to deliver", "target", forward.ClientName, "id", id)
+		c.rejectForward(wrapper, forward)
+		return
+	}
+	c.log().Debug("forwarding packet", "target", forward.ClientName, "id", id)
+	target.QueuePacket(delivered)
+}
 
-	c.logger.Debug("found packet constructor", "packetID", packetID)
-	packet := constructor()
-	if err := packet.Read(payloadBuf); err != nil {
-		return nil, fmt.Errorf("failed to read packet: %w", err)
+// forwardable reports whether a packet of the ID may be delivered by Forward.
+func forwardable(id uint64) bool {
+	switch id {
+	case protocol.IDHandshake, protocol.IDServerHandshake, protocol.IDDisconnect, protocol.IDPing, protocol.IDPong,
+		protocol.IDReconnect, protocol.IDForward, protocol.IDAuthChallenge, protocol.IDAuthResponse:
+		return false
 	}
+	return true
+}
 
-	wrapper.P = packet
-	return wrapper, nil
+// rejectForward replies to the Forward that could not be delivered with an empty Forward
+// carrying the same ClientName and, if the Forward expected a response, the same response ID.
+func (c *Conn) rejectForward(wrapper *protocol.Wrapper, forward *protocol.Forward) {
+	c.QueuePacket(&protocol.Wrapper{
+		P:          &protocol.Forward{ClientName: forward.ClientName},
+		Response:   wrapper.Response,
+		ResponseID: wrapper.ResponseID,
+	})
 }
 
 // Handler sets packet handler for this connection.
 func (c *Conn) Handler(h Handler) {
+	c.mu.Lock()
 	c.h = h
+	c.buildChain()
+	c.mu.Unlock()
 }
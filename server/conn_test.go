@@ -0,0 +1,1239 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+	"github.com/alvin0319/go-stargate-server/server"
+	"github.com/alvin0319/go-stargate-server/servertest"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetLogLoggerLevel(slog.LevelError)
+	os.Exit(m.Run())
+}
+
+const testPassword = "secret"
+
+// newServer returns a servertest.Server authenticating clients with testPassword, closed at the end of the test.
+func newServer(t *testing.T, conf server.ListenConfig) *servertest.Server {
+	t.Helper()
+	if conf.Authenticator == nil {
+		conf.Authenticator = server.PasswordAuthenticator{Password: testPassword}
+	}
+	srv := servertest.NewServer(conf)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// connect dials the server and authenticates with the name, returning the client and its server side.
+func connect(t *testing.T, srv *servertest.Server, name string) (*servertest.Client, *server.Conn) {
+	t.Helper()
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	if err := c.Handshake(types.HandshakeData{ClientName: name, Password: testPassword}); err != nil {
+		t.Fatalf("handshake of %s: %v", name, err)
+	}
+	return c, srv.Accept()
+}
+
+// disconnectCounter counts the OnDisconnect calls of every connection.
+type disconnectCounter struct {
+	server.NopLifecycleHandler
+	n atomic.Int32
+}
+
+func (d *disconnectCounter) OnDisconnect(*server.Conn, server.DisconnectInfo) {
+	d.n.Add(1)
+}
+
+// lifecycleRecorder records the lifecycle events of every connection.
+type lifecycleRecorder struct {
+	mu     sync.Mutex
+	states [][2]int
+
+	authFailed   chan error
+	disconnected chan server.DisconnectInfo
+}
+
+func newLifecycleRecorder() *lifecycleRecorder {
+	return &lifecycleRecorder{
+		authFailed:   make(chan error, 16),
+		disconnected: make(chan server.DisconnectInfo, 16),
+	}
+}
+
+func (r *lifecycleRecorder) OnStateChange(_ *server.Conn, from, to int) {
+	r.mu.Lock()
+	r.states = append(r.states, [2]int{from, to})
+	r.mu.Unlock()
+}
+
+func (r *lifecycleRecorder) OnAuthenticated(*server.Conn) {}
+
+func (r *lifecycleRecorder) OnAuthFailed(_ *server.Conn, err error) {
+	r.authFailed <- err
+}
+
+func (r *lifecycleRecorder) OnDisconnect(_ *server.Conn, info server.DisconnectInfo) {
+	r.disconnected <- info
+}
+
+// stateChanges returns the state changes recorded so far.
+func (r *lifecycleRecorder) stateChanges() [][2]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.states)
+}
+
+// nextAuthFailure waits for the next OnAuthFailed call and returns its error.
+func (r *lifecycleRecorder) nextAuthFailure(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-r.authFailed:
+		return err
+	case <-time.After(servertest.DefaultTimeout):
+		t.Fatal("OnAuthFailed was not called")
+		return nil
+	}
+}
+
+// nextDisconnect waits for the next OnDisconnect call and returns its DisconnectInfo.
+func (r *lifecycleRecorder) nextDisconnect(t *testing.T) server.DisconnectInfo {
+	t.Helper()
+	select {
+	case info := <-r.disconnected:
+		return info
+	case <-time.After(servertest.DefaultTimeout):
+		t.Fatal("OnDisconnect was not called")
+		return server.DisconnectInfo{}
+	}
+}
+
+func TestQueuePacketConcurrent(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	const goroutines, perGoroutine = 8, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				conn.QueuePacket(&protocol.Wrapper{P: &protocol.ServerTransfer{
+					PlayerName:   fmt.Sprint(g),
+					TargetServer: fmt.Sprint(i),
+				}})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Packets of each goroutine must arrive exactly once and in the order they were queued.
+	next := make(map[string]int)
+	for n := 0; n < goroutines*perGoroutine; n++ {
+		pk, err := servertest.Expect[protocol.ServerTransfer](c, servertest.DefaultTimeout)
+		if err != nil {
+			t.Fatalf("packet %d: %v", n, err)
+		}
+		if want := fmt.Sprint(next[pk.PlayerName]); pk.TargetServer != want {
+			t.Fatalf("goroutine %s: got packet %s, want %s", pk.PlayerName, pk.TargetServer, want)
+		}
+		next[pk.PlayerName]++
+	}
+}
+
+func TestSendRequestConcurrent(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	const requests = 50
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			name := fmt.Sprint("player-", i)
+			resp, err := conn.PlayerPing(context.Background(), name)
+			if err == nil && resp.PlayerName != name {
+				err = fmt.Errorf("got response for %s, want %s", resp.PlayerName, name)
+			}
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < requests; i++ {
+		w, err := c.Next(servertest.DefaultTimeout)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		req, ok := w.P.(*protocol.PlayerPingRequest)
+		if !ok || !w.Response {
+			t.Fatalf("expected PlayerPingRequest expecting response, got %T %+v", w.P, w)
+		}
+		if err := c.SendWrapper(&protocol.Wrapper{
+			P:          &protocol.PlayerPingResponse{PlayerName: req.PlayerName, UpstreamPing: 1},
+			Response:   true,
+			ResponseID: w.ResponseID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDisconnectAndCloseConcurrent(t *testing.T) {
+	counter := &disconnectCounter{}
+	srv := newServer(t, server.ListenConfig{Lifecycle: counter})
+	c, conn := connect(t, srv, "lobby")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				conn.QueuePacket(&protocol.Wrapper{P: &protocol.Ping{PingTime: int64(i)}})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			conn.DisconnectAndClose("bye")
+		}()
+	}
+	// A request pending while the connection closes must fail instead of hanging.
+	_, reqErr := server.Request[protocol.PlayerPingResponse](context.Background(), conn, &protocol.PlayerPingRequest{PlayerName: "Steve"})
+	wg.Wait()
+
+	received, err := c.Closed(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disconnects := 0
+	for _, w := range received {
+		if _, ok := w.P.(*protocol.Disconnect); ok {
+			disconnects++
+		}
+	}
+	if disconnects != 1 {
+		t.Errorf("got %d Disconnect packets, want 1", disconnects)
+	}
+	if reqErr == nil {
+		t.Error("Request succeeded on a closed connection")
+	}
+	if n := counter.n.Load(); n != 1 {
+		t.Errorf("OnDisconnect called %d times, want 1", n)
+	}
+	if conn.State() != server.StateDisconnected {
+		t.Errorf("state is %d, want StateDisconnected", conn.State())
+	}
+}
+
+func TestHandlerSwapDuringReads(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	var handled atomic.Int32
+	handler := server.HandlerFunc(func(w *protocol.Wrapper) error {
+		if _, ok := w.P.(*protocol.ServerTransfer); ok {
+			handled.Add(1)
+		}
+		return nil
+	})
+
+	const packets = 500
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < packets; i++ {
+			conn.Handler(handler)
+			conn.Use(func(_ *server.Conn, next server.Handler) server.Handler { return next })
+		}
+	}()
+	conn.Handler(handler)
+	for i := 0; i < packets; i++ {
+		if err := c.Send(&protocol.ServerTransfer{PlayerName: "Steve", TargetServer: "game"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if err := c.Sync(servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if n := handled.Load(); n != packets {
+		t.Errorf("handled %d packets, want %d", n, packets)
+	}
+}
+
+// recordingListener wraps the connections accepted from a servertest.PipeListener in recordingConns.
+type recordingListener struct {
+	*servertest.PipeListener
+	writes chan []byte
+	done   chan struct{}
+}
+
+func (l *recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.PipeListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: conn, writes: l.writes, done: l.done}, nil
+}
+
+// recordingConn passes every write to the test, blocking the writer until the test receives it
+// or done is closed.
+type recordingConn struct {
+	net.Conn
+	writes chan []byte
+	done   chan struct{}
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	select {
+	case c.writes <- slices.Clone(b[:n]):
+	case <-c.done:
+	}
+	return n, err
+}
+
+// frames decodes the frames of a single write.
+func frames(t *testing.T, b []byte) []*protocol.Wrapper {
+	t.Helper()
+	var wrappers []*protocol.Wrapper
+	dec := protocol.NewDecoder(bytes.NewReader(b), nil)
+	for {
+		w, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return wrappers
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrappers = append(wrappers, w)
+	}
+}
+
+func TestTickFlushesQueuedPackets(t *testing.T) {
+	frame, err := protocol.AppendFrame(nil, &protocol.Wrapper{P: &protocol.Ping{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(frame)
+
+	tests := []struct {
+		name                 string
+		maxPackets, maxBytes int
+		// want is the number of packets in each write.
+		want []int
+	}{
+		{"no budget", 0, 0, []int{5}},
+		{"packet budget", 2, 0, []int{2, 2, 1}},
+		{"byte budget", 0, 2*size + size/2, []int{2, 2, 1}},
+		{"byte budget under one packet", 0, size / 2, []int{1, 1, 1, 1, 1}},
+		{"both budgets", 3, 2 * size, []int{2, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := servertest.NewPipeListener()
+			rl := &recordingListener{PipeListener: pipe, writes: make(chan []byte), done: make(chan struct{})}
+			l, err := server.ListenConfig{
+				Authenticator: server.PasswordAuthenticator{Password: testPassword},
+				Clock:         servertest.NewClock(time.Unix(0, 0)),
+			}.Serve(rl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(l.Close)
+			t.Cleanup(func() { close(rl.done) })
+
+			conn, err := pipe.Dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := servertest.NewClient(conn, l.Registry())
+			defer c.Close()
+			srvConn := l.Accept()
+			if err := c.Send(&protocol.Handshake{Data: types.HandshakeData{ClientName: "lobby", Password: testPassword}}); err != nil {
+				t.Fatal(err)
+			}
+			if w := frames(t, <-rl.writes); len(w) != 1 {
+				t.Fatalf("got %d packets in the handshake write, want 1", len(w))
+			}
+			if _, err := servertest.Expect[protocol.ServerHandshake](c, servertest.DefaultTimeout); err != nil {
+				t.Fatal(err)
+			}
+
+			srvConn.SetTickBudget(tt.maxPackets, tt.maxBytes)
+			// The tick is blocked in the write of the first packet until it is received, so that the other
+			// packets are all queued before the next tick.
+			srvConn.QueuePacket(&protocol.Wrapper{P: &protocol.Ping{PingTime: -1}})
+			first := <-rl.writes
+			for i := 0; i < 5; i++ {
+				srvConn.QueuePacket(&protocol.Wrapper{P: &protocol.Ping{PingTime: int64(i)}})
+			}
+			if w := frames(t, first); len(w) != 1 {
+				t.Fatalf("got %d packets in the first write, want 1", len(w))
+			}
+
+			var got []int
+			next := int64(0)
+			for next < 5 {
+				b := <-rl.writes
+				if tt.maxBytes > 0 && len(b) > max(tt.maxBytes, size) {
+					t.Errorf("wrote %d bytes in a tick, want at most %d", len(b), tt.maxBytes)
+				}
+				w := frames(t, b)
+				for _, wrapper := range w {
+					if pk, ok := wrapper.P.(*protocol.Ping); !ok || pk.PingTime != next {
+						t.Fatalf("got %T %+v, want ping %d", wrapper.P, wrapper.P, next)
+					}
+					next++
+				}
+				got = append(got, len(w))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v packets per write, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+	// A second client takes the name while the first one is still connected.
+	other, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Reconnect("restarting")
+	received, err := c.Closed(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) == 0 {
+		t.Fatal("no packet received before close")
+	}
+	if pk, ok := received[len(received)-1].P.(*protocol.Reconnect); !ok || pk.Reason != "restarting" {
+		t.Fatalf("last packet is %T %+v, want Reconnect", received[len(received)-1].P, received[len(received)-1].P)
+	}
+
+	if err := other.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err != nil {
+		t.Fatalf("returning client: %v", err)
+	}
+	if returned := srv.Accept(); returned.Name != "lobby" {
+		t.Errorf("returning client is named %q, want lobby", returned.Name)
+	}
+}
+
+func TestDuplicateKickOld(t *testing.T) {
+	counter := &disconnectCounter{}
+	srv := newServer(t, server.ListenConfig{DuplicateNames: server.DuplicateKickOld, Lifecycle: counter})
+	old, _ := connect(t, srv, "lobby")
+	_, conn := connect(t, srv, "lobby")
+
+	received, err := old.Closed(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) == 0 {
+		t.Fatal("kicked client received nothing")
+	}
+	if _, ok := received[len(received)-1].P.(*protocol.Disconnect); !ok {
+		t.Errorf("last packet is %T, want Disconnect", received[len(received)-1].P)
+	}
+	if got, ok := srv.Conn("lobby"); !ok || got != conn {
+		t.Error("name is not held by the new connection")
+	}
+	if n := counter.n.Load(); n != 1 {
+		t.Errorf("OnDisconnect called %d times, want 1", n)
+	}
+}
+
+func TestDuplicateKickOldDoesNotWait(t *testing.T) {
+	pipe := servertest.NewPipeListener()
+	l, err := server.ListenConfig{
+		Authenticator:  server.PasswordAuthenticator{Password: testPassword},
+		DuplicateNames: server.DuplicateKickOld,
+		WriteTimeout:   time.Minute,
+	}.Serve(pipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.Close)
+	dialNotReading(t, pipe, l, "lobby")
+
+	conn, err := pipe.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := servertest.NewClient(conn, l.Registry())
+	defer c.Close()
+	newConn := l.Accept()
+	// The old client does not read its Disconnect, which must not hold back the new client for the write timeout.
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if got, ok := l.Conn("lobby"); !ok || got != newConn {
+		t.Error("name is not held by the new connection")
+	}
+}
+
+func TestDuplicateReject(t *testing.T) {
+	recorder := newLifecycleRecorder()
+	srv := newServer(t, server.ListenConfig{Lifecycle: recorder})
+	_, conn := connect(t, srv, "lobby")
+
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	srv.Accept()
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err == nil {
+		t.Fatal("duplicate name was accepted")
+	}
+	if err := recorder.nextAuthFailure(t); !errors.Is(err, server.ErrDuplicateName) {
+		t.Errorf("got error %v, want ErrDuplicateName", err)
+	}
+	if got, ok := srv.Conn("lobby"); !ok || got != conn {
+		t.Error("name is not held by the first connection")
+	}
+}
+
+func TestDuplicateSuffix(t *testing.T) {
+	recorder := newLifecycleRecorder()
+	srv := newServer(t, server.ListenConfig{DuplicateNames: server.DuplicateSuffix, Lifecycle: recorder})
+	_, first := connect(t, srv, "lobby")
+	second, secondConn := connect(t, srv, "lobby")
+	_, third := connect(t, srv, "lobby")
+	for conn, want := range map[*server.Conn]string{first: "lobby", secondConn: "lobby#2", third: "lobby#3"} {
+		if conn.Name != want {
+			t.Errorf("got name %q, want %s", conn.Name, want)
+		}
+	}
+
+	_ = second.Close()
+	recorder.nextDisconnect(t)
+	if _, ok := srv.Conn("lobby#2"); ok {
+		t.Fatal("lobby#2 is still held after its client disconnected")
+	}
+	if _, conn := connect(t, srv, "lobby"); conn.Name != "lobby#2" {
+		t.Errorf("got name %q after lobby#2 was freed, want lobby#2", conn.Name)
+	}
+}
+
+func TestDuplicateSuffixReconnect(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{DuplicateNames: server.DuplicateSuffix})
+	_, first := connect(t, srv, "lobby")
+	c, conn := connect(t, srv, "lobby")
+	other, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	conn.Reconnect("restarting")
+	if _, err := c.Closed(servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	// The client only knows the name of its handshake. It is accepted as a new client rather than taking
+	// over the name, which would kick the first client.
+	if err := other.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err != nil {
+		t.Fatalf("returning client: %v", err)
+	}
+	if returned := srv.Accept(); returned.Name != "lobby#2" {
+		t.Errorf("returning client is named %q, want lobby#2", returned.Name)
+	}
+	if got, ok := srv.Conn("lobby"); !ok || got != first {
+		t.Error("first client lost its name to the returning client")
+	}
+}
+
+func TestAuthenticatedConnections(t *testing.T) {
+	recorder := newLifecycleRecorder()
+	srv := newServer(t, server.ListenConfig{Lifecycle: recorder})
+	connect(t, srv, "lobby")
+	connect(t, srv, "game")
+	closed, _ := connect(t, srv, "closed")
+	connect(t, srv, "hub")
+
+	// A client that has not sent its handshake yet is not authenticated.
+	pending, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pending.Close()
+	srv.Accept()
+
+	_ = closed.Close()
+	recorder.nextDisconnect(t)
+
+	var names []string
+	for _, conn := range srv.AuthenticatedConnections() {
+		names = append(names, conn.Name)
+	}
+	if want := []string{"game", "hub", "lobby"}; !slices.Equal(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+	if n := len(srv.Connections()); n != 4 {
+		t.Errorf("got %d connections, want 4 including the unauthenticated one", n)
+	}
+}
+
+func TestDisconnectCause(t *testing.T) {
+	tests := []struct {
+		name   string
+		close  func(t *testing.T, srv *servertest.Server, c *servertest.Client)
+		cause  server.DisconnectCause
+		reason string
+	}{
+		{"client disconnect", func(t *testing.T, _ *servertest.Server, c *servertest.Client) {
+			if err := c.Send(&protocol.Disconnect{Reason: "bye"}); err != nil {
+				t.Fatal(err)
+			}
+		}, server.DisconnectClient, "bye"},
+		{"ping timeout", func(t *testing.T, srv *servertest.Server, c *servertest.Client) {
+			srv.Clock.Advance(server.PingInterval)
+			if _, err := servertest.Expect[protocol.Ping](c, servertest.DefaultTimeout); err != nil {
+				t.Fatal(err)
+			}
+			srv.Clock.Advance(server.PingTimeout)
+		}, server.DisconnectPingTimeout, "Ping timeout"},
+		{"read error", func(_ *testing.T, _ *servertest.Server, c *servertest.Client) {
+			_ = c.Close()
+		}, server.DisconnectReadError, ""},
+		{"shutdown", func(_ *testing.T, srv *servertest.Server, _ *servertest.Client) {
+			srv.Close()
+		}, server.DisconnectShutdown, "StarGate server shutdown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newLifecycleRecorder()
+			// The listener is not closed by newServer, as the shutdown case closes it.
+			srv := servertest.NewServer(server.ListenConfig{
+				Authenticator: server.PasswordAuthenticator{Password: testPassword},
+				Lifecycle:     recorder,
+			})
+			if tt.cause != server.DisconnectShutdown {
+				defer srv.Close()
+			}
+			c, _ := connect(t, srv, "lobby")
+
+			tt.close(t, srv, c)
+			info := recorder.nextDisconnect(t)
+			if info.Cause != tt.cause || info.Reason != tt.reason {
+				t.Errorf("got cause %d with reason %q, want %d with %q", info.Cause, info.Reason, tt.cause, tt.reason)
+			}
+			if (info.Err != nil) != (tt.cause == server.DisconnectReadError) {
+				t.Errorf("got error %v", info.Err)
+			}
+			want := [][2]int{
+				{server.StateAuthenticating, server.StateConnected},
+				{server.StateConnected, server.StateDisconnected},
+			}
+			if got := recorder.stateChanges(); !slices.Equal(got, want) {
+				t.Errorf("got state changes %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLifecycleAuthFailed(t *testing.T) {
+	recorder := newLifecycleRecorder()
+	srv := newServer(t, server.ListenConfig{Lifecycle: recorder})
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	srv.Accept()
+
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: "wrong"}); err == nil {
+		t.Fatal("wrong password was accepted")
+	}
+	if err := recorder.nextAuthFailure(t); !errors.Is(err, server.ErrInvalidPassword) {
+		t.Errorf("got error %v, want ErrInvalidPassword", err)
+	}
+	if info := recorder.nextDisconnect(t); info.Cause != server.DisconnectAuthFailed {
+		t.Errorf("got disconnect cause %d, want DisconnectAuthFailed", info.Cause)
+	}
+	want := [][2]int{{server.StateAuthenticating, server.StateDisconnected}}
+	if got := recorder.stateChanges(); !slices.Equal(got, want) {
+		t.Errorf("got state changes %v, want %v", got, want)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	silent, _ := connect(t, srv, "silent")
+	answering, _ := connect(t, srv, "answering")
+
+	srv.Clock.Advance(server.PingInterval)
+	if _, err := servertest.Expect[protocol.Ping](silent, servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	ping, err := servertest.Expect[protocol.Ping](answering, servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := answering.Send(&protocol.Pong{PingTime: ping.PingTime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := answering.Sync(servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Clock.Advance(server.PingTimeout)
+	received, err := silent.Closed(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) == 0 {
+		t.Fatal("timed out client received nothing")
+	}
+	if pk, ok := received[len(received)-1].P.(*protocol.Disconnect); !ok || pk.Reason != "Ping timeout" {
+		t.Errorf("last packet is %T %+v, want Disconnect for ping timeout", received[len(received)-1].P, received[len(received)-1].P)
+	}
+	if _, ok := srv.Conn("answering"); !ok {
+		t.Error("answering client was disconnected")
+	}
+}
+
+func TestForwardFailureReplies(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, _ := connect(t, srv, "lobby")
+	target, _ := connect(t, srv, "game")
+
+	nested, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Forward{
+		ClientName: "lobby",
+		Payload:    []byte{protocol.IDPing, 0},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		forward *protocol.Forward
+	}{
+		{"not connected", &protocol.Forward{ClientName: "missing", Payload: []byte{protocol.IDPing, 0, 0, 0, 0, 0, 0, 0, 0, 0}}},
+		{"decode failure", &protocol.Forward{ClientName: "game", Payload: []byte{protocol.IDPing}}},
+		{"nested forward", &protocol.Forward{ClientName: "game", Payload: nested}},
+	}
+	// Packets the server uses to control connections.
+	for _, p := range []protocol.Packet{
+		&protocol.Disconnect{Reason: "bye"},
+		&protocol.ServerHandshake{Success: false},
+		&protocol.Reconnect{Reason: "restarting"},
+		&protocol.Ping{PingTime: 1},
+		&protocol.AuthChallenge{Nonce: []byte{1}},
+	} {
+		payload, err := protocol.EncodePayload(&protocol.Wrapper{P: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, struct {
+			name    string
+			forward *protocol.Forward
+		}{fmt.Sprintf("%T", p), &protocol.Forward{ClientName: "game", Payload: payload}})
+	}
+	for _, tt := range tests {
+		for _, response := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/response=%v", tt.name, response), func(t *testing.T) {
+				if err := c.SendWrapper(&protocol.Wrapper{P: tt.forward, Response: response, ResponseID: 7}); err != nil {
+					t.Fatal(err)
+				}
+				w, err := c.Next(servertest.DefaultTimeout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reply, ok := w.P.(*protocol.Forward)
+				if !ok {
+					t.Fatalf("got %T, want Forward", w.P)
+				}
+				if reply.ClientName != tt.forward.ClientName || len(reply.Payload) != 0 {
+					t.Errorf("got %+v, want empty Forward to %s", reply, tt.forward.ClientName)
+				}
+				if w.Response != response || (response && w.ResponseID != 7) {
+					t.Errorf("got response %v with ID %d, want %v with ID 7", w.Response, w.ResponseID, response)
+				}
+			})
+		}
+	}
+
+	// Nothing must have been delivered to the target.
+	if err := target.Sync(servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := target.Next(100 * time.Millisecond); err == nil {
+		t.Errorf("target received %T", w.P)
+	}
+}
+
+func TestForwardDelivers(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, _ := connect(t, srv, "lobby")
+	target, _ := connect(t, srv, "game")
+
+	// A response the target could mistake for the answer of the server to its own request.
+	payload, err := protocol.EncodePayload(&protocol.Wrapper{
+		P:          &protocol.ServerInfoResponse{ServerName: "game"},
+		Response:   true,
+		ResponseID: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.Forward{ClientName: "game", Payload: payload}, Response: true, ResponseID: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := target.Next(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forward, ok := w.P.(*protocol.Forward)
+	if !ok {
+		t.Fatalf("got %T, want Forward", w.P)
+	}
+	if forward.ClientName != "lobby" || !bytes.Equal(forward.Payload, payload) {
+		t.Errorf("got %+v, want Forward from lobby with the payload", forward)
+	}
+	if w.Response {
+		t.Errorf("delivered Forward expects a response with ID %d", w.ResponseID)
+	}
+}
+
+func TestForwardTooLargeToDeliver(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	sender := strings.Repeat("a", server.MaxClientNameLength)
+	c, _ := connect(t, srv, sender)
+	target, _ := connect(t, srv, "b")
+
+	// The Forward to b fits in a frame, but not once delivered with the longer name of the sender.
+	header, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Forward{ClientName: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, protocol.MaxPayloadLength-len(header))
+	payload[0] = 0x64 // unregistered, so it is forwarded as an Unknown packet
+	if err := c.Send(&protocol.Forward{ClientName: "b", Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := servertest.Expect[protocol.Forward](c, servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.ClientName != "b" || len(reply.Payload) != 0 {
+		t.Errorf("got %+v, want empty Forward to b", reply)
+	}
+	if err := target.Sync(servertest.DefaultTimeout); err != nil {
+		t.Fatalf("target: %v", err)
+	}
+	if _, ok := srv.Conn("b"); !ok {
+		t.Error("target was disconnected")
+	}
+}
+
+func TestQueuedPacketFailingToEncode(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	conn.QueuePacket(&protocol.Wrapper{P: &protocol.Forward{ClientName: "game", Payload: make([]byte, protocol.MaxPayloadLength)}})
+	conn.QueuePacket(&protocol.Wrapper{P: &protocol.Ping{PingTime: 1}})
+	if ping, err := servertest.Expect[protocol.Ping](c, servertest.DefaultTimeout); err != nil || ping.PingTime != 1 {
+		t.Fatalf("got %+v, %v, want the packet queued after the dropped one", ping, err)
+	}
+	if _, ok := srv.Conn("lobby"); !ok {
+		t.Error("connection was closed by a packet that failed to encode")
+	}
+}
+
+func TestNilInfoProvider(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	srv.InfoProvider(nil)
+	c, _ := connect(t, srv, "lobby")
+
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.ServerInfoRequest{SelfInfo: true}, Response: true, ResponseID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := servertest.Expect[protocol.ServerInfoResponse](c, servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ServerName != "lobby" {
+		t.Errorf("got server name %q, want lobby", resp.ServerName)
+	}
+}
+
+// failingInfoProvider is an InfoProvider that always fails.
+type failingInfoProvider struct{}
+
+func (failingInfoProvider) ServerInfo(*server.Conn, *protocol.ServerInfoRequest) (*protocol.ServerInfoResponse, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestInfoProviderFailureReplies(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	srv.InfoProvider(failingInfoProvider{})
+	c, _ := connect(t, srv, "lobby")
+
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.ServerInfoRequest{ServerName: "game"}, Response: true, ResponseID: 4}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.Next(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := w.P.(*protocol.ServerInfoResponse)
+	if !ok || !w.Response || w.ResponseID != 4 {
+		t.Fatalf("got %T with response ID %d, want ServerInfoResponse with 4", w.P, w.ResponseID)
+	}
+	if resp.ServerName != "" || len(resp.ServerList) != 0 {
+		t.Errorf("got %+v, want empty ServerInfoResponse", resp)
+	}
+}
+
+// countingManager counts the ServerManage packets it applies.
+type countingManager struct {
+	n atomic.Int32
+}
+
+func (m *countingManager) ManageServer(*server.Conn, *protocol.ServerManage) error {
+	m.n.Add(1)
+	return nil
+}
+
+func TestServerManageUnknownAction(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	manager := &countingManager{}
+	srv.ServerManager(manager)
+	c, _ := connect(t, srv, "lobby")
+
+	tests := []struct {
+		action, want byte
+	}{
+		{protocol.ServerManageActionAdd, protocol.ServerManageActionSuccess},
+		{protocol.ServerManageActionSuccess, protocol.ServerManageActionFailure},
+		{0xff, protocol.ServerManageActionFailure},
+	}
+	for _, tt := range tests {
+		if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.ServerManage{Action: tt.action, ServerName: "game"}, Response: true, ResponseID: 3}); err != nil {
+			t.Fatal(err)
+		}
+		w, err := c.Next(servertest.DefaultTimeout)
+		if err != nil {
+			t.Fatalf("action %d: %v", tt.action, err)
+		}
+		reply, ok := w.P.(*protocol.ServerManage)
+		if !ok || w.ResponseID != 3 {
+			t.Fatalf("action %d: got %T with response ID %d, want ServerManage with 3", tt.action, w.P, w.ResponseID)
+		}
+		if reply.Action != tt.want || reply.ServerName != "game" {
+			t.Errorf("action %d: got reply %+v, want action %d", tt.action, reply, tt.want)
+		}
+	}
+	if n := manager.n.Load(); n != 1 {
+		t.Errorf("ServerManager called %d times, want 1", n)
+	}
+}
+
+func TestRequestIgnoresClientRequestWithSameID(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	pong := make(chan error, 1)
+	go func() {
+		_, err := conn.PlayerPing(context.Background(), "Steve")
+		pong <- err
+	}()
+	w, err := c.Next(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.P.(*protocol.PlayerPingRequest); !ok {
+		t.Fatalf("got %T, want PlayerPingRequest", w.P)
+	}
+
+	// The client sends its own request with the response ID of the pending PlayerPing.
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.ServerInfoRequest{SelfInfo: true}, Response: true, ResponseID: w.ResponseID}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.Next(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := info.P.(*protocol.ServerInfoResponse); !ok || info.ResponseID != w.ResponseID {
+		t.Fatalf("got %T with response ID %d, want ServerInfoResponse with %d", info.P, info.ResponseID, w.ResponseID)
+	}
+
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.PlayerPingResponse{PlayerName: "Steve"}, Response: true, ResponseID: w.ResponseID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-pong; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// challengeHandshake sends a Handshake asking for challenge-response authentication and answers the AuthChallenge
+// with the proof of the secret. It returns the ServerHandshake.
+func challengeHandshake(t *testing.T, c *servertest.Client, name, secret string) *protocol.ServerHandshake {
+	t.Helper()
+	if err := c.Send(&protocol.Handshake{Data: types.HandshakeData{ClientName: name, Protocol: types.ProtocolChallengeAuth}}); err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := servertest.Expect[protocol.AuthChallenge](c, servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(&protocol.AuthResponse{Proof: protocol.ChallengeProof(secret, challenge.Nonce, name)}); err != nil {
+		t.Fatal(err)
+	}
+	hs, err := servertest.Expect[protocol.ServerHandshake](c, servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hs
+}
+
+func TestChallengeAuth(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{RequireChallenge: true})
+
+	tests := []struct {
+		name, secret string
+		success      bool
+	}{
+		{"valid", testPassword, true},
+		{"wrong", "wrong", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := srv.Dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			conn := srv.Accept()
+			if hs := challengeHandshake(t, c, "lobby-"+tt.name, tt.secret); hs.Success != tt.success {
+				t.Fatalf("got success %v, want %v", hs.Success, tt.success)
+			}
+			if !tt.success {
+				if _, err := c.Closed(servertest.DefaultTimeout); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if conn.State() != server.StateConnected || conn.Name != "lobby-valid" {
+				t.Errorf("got state %d and name %q, want connected lobby-valid", conn.State(), conn.Name)
+			}
+		})
+	}
+}
+
+func TestChallengeRequired(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{RequireChallenge: true})
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Accept()
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err == nil {
+		t.Fatal("plain text password was accepted")
+	}
+	if _, err := c.Closed(servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthResponseWithoutChallenge(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, err := srv.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	srv.Accept()
+
+	// An AuthResponse before the Handshake authenticates nothing and is ignored.
+	if err := c.Send(&protocol.AuthResponse{Proof: protocol.ChallengeProof(testPassword, nil, "lobby")}); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := c.Next(100 * time.Millisecond); err == nil {
+		t.Fatalf("got %T in reply to the AuthResponse", w.P)
+	}
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestFromHandler(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	c, conn := connect(t, srv, "lobby")
+
+	result := make(chan error, 1)
+	conn.Handler(server.HandlerFunc(func(w *protocol.Wrapper) error {
+		if pk, ok := w.P.(*protocol.ServerTransfer); ok {
+			_, err := conn.PlayerPing(context.Background(), pk.PlayerName)
+			result <- err
+		}
+		return nil
+	}))
+	if err := c.Send(&protocol.ServerTransfer{PlayerName: "Steve", TargetServer: "game"}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.Next(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.P.(*protocol.PlayerPingRequest); !ok {
+		t.Fatalf("got %T, want PlayerPingRequest", w.P)
+	}
+	// A packet read before the response must not hold it back.
+	if err := c.Send(&protocol.Ping{PingTime: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SendWrapper(&protocol.Wrapper{P: &protocol.PlayerPingResponse{PlayerName: "Steve"}, Response: true, ResponseID: w.ResponseID}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(servertest.DefaultTimeout):
+		t.Fatal("request from handler did not resolve")
+	}
+	if _, err := servertest.Expect[protocol.Pong](c, servertest.DefaultTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidClientName(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{})
+	for _, name := range []string{"", "lobby\x00", "lobby\n", "\xff", strings.Repeat("a", server.MaxClientNameLength+1)} {
+		c, err := srv.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.Accept()
+		if err := c.Handshake(types.HandshakeData{ClientName: name, Password: testPassword}); err == nil {
+			t.Errorf("client name %q was accepted", name)
+		}
+		_ = c.Close()
+	}
+	connect(t, srv, strings.Repeat("a", server.MaxClientNameLength))
+}
+
+func TestRecover(t *testing.T) {
+	srv := newServer(t, server.ListenConfig{Middlewares: []server.Middleware{server.Recover}})
+	c, conn := connect(t, srv, "lobby")
+	other, otherConn := connect(t, srv, "game")
+
+	panicking := server.HandlerFunc(func(w *protocol.Wrapper) error {
+		if _, ok := w.P.(*protocol.ServerTransfer); ok {
+			panic("handler bug")
+		}
+		return nil
+	})
+	conn.Handler(panicking)
+	otherConn.Handler(panicking)
+
+	if err := c.Send(&protocol.ServerTransfer{PlayerName: "Steve", TargetServer: "game"}); err != nil {
+		t.Fatal(err)
+	}
+	received, err := c.Closed(servertest.DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) == 0 {
+		t.Fatal("panicking client received nothing")
+	}
+	if _, ok := received[len(received)-1].P.(*protocol.Disconnect); !ok {
+		t.Errorf("last packet is %T, want Disconnect", received[len(received)-1].P)
+	}
+
+	if err := other.Sync(servertest.DefaultTimeout); err != nil {
+		t.Fatalf("other client: %v", err)
+	}
+	if _, ok := srv.Conn("game"); !ok {
+		t.Error("other client was disconnected")
+	}
+}
+
+// dialNotReading connects a client that authenticates with the name and then stops reading.
+func dialNotReading(t *testing.T, pipe *servertest.PipeListener, l *server.Listener, name string) {
+	t.Helper()
+	conn, err := pipe.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	l.Accept()
+	if err := protocol.NewEncoder(conn).Encode(&protocol.Wrapper{P: &protocol.Handshake{Data: types.HandshakeData{ClientName: name, Password: testPassword}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := protocol.NewDecoder(conn, l.Registry()).Decode(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	pipe := servertest.NewPipeListener()
+	l, err := server.ListenConfig{
+		Authenticator:  server.PasswordAuthenticator{Password: testPassword},
+		DuplicateNames: server.DuplicateKickOld,
+		WriteTimeout:   100 * time.Millisecond,
+	}.Serve(pipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialNotReading(t, pipe, l, "lobby")
+	dialNotReading(t, pipe, l, "game")
+
+	// Kicking the old client must not block the authentication of the new one.
+	conn, err := pipe.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := servertest.NewClient(conn, l.Registry())
+	defer c.Close()
+	l.Accept()
+	if err := c.Handshake(types.HandshakeData{ClientName: "lobby", Password: testPassword}); err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	// Neither must closing the listener wait for a client that does not read.
+	closed := make(chan struct{})
+	go func() {
+		l.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(servertest.DefaultTimeout):
+		t.Fatal("Close blocked on a client that does not read")
+	}
+}
@@ -0,0 +1,162 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/internal/testpacket"
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/golden"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+	"github.com/alvin0319/go-stargate-server/server"
+	"github.com/alvin0319/go-stargate-server/servertest"
+)
+
+// fuzzRegistry returns a registry mapping the built-in IDs handled by the server to other packets,
+// so that the server cannot assume the packet of an ID, and with testpacket.Panic registered.
+// The packets used to authenticate and to Sync keep their IDs.
+func fuzzRegistry(tb testing.TB) *protocol.Registry {
+	ids := []uint64{
+		protocol.IDDisconnect, protocol.IDReconnect, protocol.IDForward, protocol.IDServerInfoRequest,
+		protocol.IDServerInfoResponse, protocol.IDServerTransfer, protocol.IDPlayerPingRequest,
+		protocol.IDPlayerPingResponse, protocol.IDServerManage,
+	}
+	packets := []func() protocol.Packet{
+		func() protocol.Packet { return &protocol.Disconnect{} },
+		func() protocol.Packet { return &protocol.Reconnect{} },
+		func() protocol.Packet { return &protocol.Forward{} },
+		func() protocol.Packet { return &protocol.ServerInfoRequest{} },
+		func() protocol.Packet { return &protocol.ServerInfoResponse{} },
+		func() protocol.Packet { return &protocol.ServerTransfer{} },
+		func() protocol.Packet { return &protocol.PlayerPingRequest{} },
+		func() protocol.Packet { return &protocol.PlayerPingResponse{} },
+		func() protocol.Packet { return &protocol.ServerManage{} },
+	}
+	reg := protocol.NewRegistry()
+	register := func(id uint64, f func() protocol.Packet) {
+		if err := reg.Register(id, f); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	for i, id := range ids {
+		register(id, packets[(i+1)%len(packets)])
+	}
+	register(protocol.IDHandshake, func() protocol.Packet { return &protocol.Handshake{} })
+	register(protocol.IDServerHandshake, func() protocol.Packet { return &protocol.ServerHandshake{} })
+	register(protocol.IDPing, func() protocol.Packet { return &protocol.Ping{} })
+	register(protocol.IDPong, func() protocol.Packet { return &protocol.Pong{} })
+	register(protocol.IDAuthChallenge, func() protocol.Packet { return &protocol.AuthChallenge{} })
+	register(protocol.IDAuthResponse, func() protocol.Packet { return &protocol.AuthResponse{} })
+	register(testpacket.IDPanic, func() protocol.Packet { return &testpacket.Panic{} })
+	return reg
+}
+
+// handshakePayload returns the payload of a Handshake with the client name.
+func handshakePayload(tb testing.TB, name string) []byte {
+	b, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Handshake{Data: types.HandshakeData{ClientName: name, Password: testPassword}}})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// FuzzConnPayload sends the payload in a frame to the server, either before or after the handshake,
+// with either the default registry or fuzzRegistry. The server must neither panic nor stop serving.
+func FuzzConnPayload(f *testing.F) {
+	for _, v := range golden.Vectors {
+		f.Add(false, true, v.Frame[6:])
+	}
+	// Invalid client names.
+	for _, name := range []string{"", "lobby\x00", "\xff", strings.Repeat("a", server.MaxClientNameLength+1)} {
+		f.Add(false, false, handshakePayload(f, name))
+	}
+	// A nested Forward to the fuzzing client itself.
+	nested, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Forward{ClientName: "target", Payload: []byte{protocol.IDPing, 0}}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	forward, err := protocol.EncodePayload(&protocol.Wrapper{P: &protocol.Forward{ClientName: "target", Payload: nested}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(false, true, forward)
+	// Built-in IDs decoded to other packets by a custom registry, and a packet panicking in Read.
+	for _, v := range golden.Vectors {
+		f.Add(true, true, v.Frame[6:])
+	}
+	f.Add(true, true, []byte{testpacket.IDPanic, 0, 1})
+	f.Add(true, false, []byte{testpacket.IDPanic, 0, 1})
+	// Frames the server cannot read.
+	f.Add(false, true, []byte{})
+	f.Add(false, true, bytes.Repeat([]byte{0xff}, 64))
+
+	servers := make(map[bool]*servertest.Server)
+	for _, custom := range []bool{false, true} {
+		conf := server.ListenConfig{Authenticator: server.PasswordAuthenticator{Password: testPassword}}
+		if custom {
+			conf.Registry = fuzzRegistry(f)
+		}
+		srv := servertest.NewServer(conf)
+		f.Cleanup(srv.Close)
+		servers[custom] = srv
+		// The target of forwarded packets.
+		target, err := srv.Dial()
+		if err != nil {
+			f.Fatal(err)
+		}
+		if err := target.Handshake(types.HandshakeData{ClientName: "target", Password: testPassword}); err != nil {
+			f.Fatal(err)
+		}
+		srv.Accept()
+		go func() {
+			// Keep reading, as writes to the target block until they are read.
+			for {
+				if _, err := target.Next(time.Hour); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	var n atomic.Int64
+	f.Fuzz(func(t *testing.T, custom, authenticated bool, payload []byte) {
+		srv := servers[custom]
+		c, err := srv.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		srv.Accept()
+		if authenticated {
+			if err := c.Handshake(types.HandshakeData{ClientName: fmt.Sprint("fuzz-", n.Add(1)), Password: testPassword}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		frame := binary.BigEndian.AppendUint16(nil, protocol.StarGateMagic)
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+		_ = c.SendRaw(append(frame, payload...))
+		if authenticated {
+			// Fails early if the server closed the connection.
+			_ = c.Sync(100 * time.Millisecond)
+		} else {
+			_, _ = c.Next(50 * time.Millisecond)
+		}
+
+		// Whatever was sent, the server must still serve new clients.
+		check, err := srv.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer check.Close()
+		srv.Accept()
+		if err := check.Handshake(types.HandshakeData{ClientName: fmt.Sprint("check-", n.Add(1)), Password: testPassword}); err != nil {
+			t.Fatalf("server stopped serving: %v", err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import "github.com/alvin0319/go-stargate-server/protocol"
+
+// InfoProvider provides the information used to answer ServerInfoRequest packets.
+type InfoProvider interface {
+	// ServerInfo returns the information requested by the given connection.
+	// If it returns an error, the client is replied an empty ServerInfoResponse.
+	ServerInfo(c *Conn, req *protocol.ServerInfoRequest) (*protocol.ServerInfoResponse, error)
+}
+
+// DefaultInfoProvider answers ServerInfoRequest packets with the names of connected clients.
+// Player counts are left empty as they are only known to the proxy.
+type DefaultInfoProvider struct {
+	l *Listener
+}
+
+func (p DefaultInfoProvider) ServerInfo(c *Conn, req *protocol.ServerInfoRequest) (*protocol.ServerInfoResponse, error) {
+	resp := &protocol.ServerInfoResponse{
+		ServerName: req.ServerName,
+		SelfInfo:   req.SelfInfo,
+	}
+	if req.SelfInfo {
+		resp.ServerName = c.Name
+	}
+	if resp.ServerName == "" {
+		for _, conn := range p.l.AuthenticatedConnections() {
+			resp.ServerList = append(resp.ServerList, conn.Name)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+// DisconnectCause is the cause of a connection being closed.
+type DisconnectCause int
+
+const (
+	// DisconnectClient is the cause when the client sent a Disconnect packet.
+	DisconnectClient DisconnectCause = iota
+	// DisconnectServer is the cause when the connection was closed by Conn.DisconnectAndClose,
+	// including when it was kicked in favour of a client with the same name.
+	DisconnectServer
+	// DisconnectReconnect is the cause when the client was asked to reconnect by Conn.Reconnect.
+	DisconnectReconnect
+	// DisconnectAuthFailed is the cause when the client failed to authenticate.
+	DisconnectAuthFailed
+	// DisconnectPingTimeout is the cause when the client did not answer a Ping in PingTimeout.
+	DisconnectPingTimeout
+	// DisconnectReadError is the cause when a packet could not be read, including when the client closed the socket.
+	DisconnectReadError
+	// DisconnectWriteError is the cause when a packet could not be written.
+	DisconnectWriteError
+	// DisconnectShutdown is the cause when the listener was closed.
+	DisconnectShutdown
+)
+
+// DisconnectInfo describes why a connection was closed.
+type DisconnectInfo struct {
+	// Cause is the cause of disconnection.
+	Cause DisconnectCause
+	// Reason is the reason sent in or received from the Disconnect packet, if any.
+	Reason string
+	// Err is the error that closed the connection, if any.
+	Err error
+}
+
+// LifecycleHandler is notified of the lifecycle events of connections.
+// A Handler set by Conn.Handler may implement it to be notified of its connection, and
+// ListenConfig.Lifecycle is notified of every connection of the listener.
+// The methods may be called from any goroutine and must not block.
+type LifecycleHandler interface {
+	// OnStateChange is called when the state of the connection changed.
+	OnStateChange(c *Conn, from, to int)
+	// OnAuthenticated is called when the client authenticated successfully.
+	OnAuthenticated(c *Conn)
+	// OnAuthFailed is called when the client failed to authenticate.
+	OnAuthFailed(c *Conn, err error)
+	// OnDisconnect is called after the connection was closed.
+	OnDisconnect(c *Conn, info DisconnectInfo)
+}
+
+// NopLifecycleHandler implements LifecycleHandler with methods that do nothing.
+// It may be embedded to implement only some of the methods.
+type NopLifecycleHandler struct{}
+
+func (NopLifecycleHandler) OnStateChange(*Conn, int, int)      {}
+func (NopLifecycleHandler) OnAuthenticated(*Conn)              {}
+func (NopLifecycleHandler) OnAuthFailed(*Conn, error)          {}
+func (NopLifecycleHandler) OnDisconnect(*Conn, DisconnectInfo) {}
+
+// lifecycleHandlers returns the lifecycle handlers to notify of the events of given connection.
+func (c *Conn) lifecycleHandlers() []LifecycleHandler {
+	var handlers []LifecycleHandler
+	if c.listener != nil && c.listener.lifecycle != nil {
+		handlers = append(handlers, c.listener.lifecycle)
+	}
+	c.mu.Lock()
+	h := c.h
+	c.mu.Unlock()
+	if lh, ok := h.(LifecycleHandler); ok {
+		handlers = append(handlers, lh)
+	}
+	return handlers
+}
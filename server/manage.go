@@ -0,0 +1,17 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+)
+
+// errNoServerManager is returned when a ServerManage packet is received without a ServerManager set.
+var errNoServerManager = errors.New("no server manager set")
+
+// ServerManager applies ServerManage requests to the server list of the proxy.
+type ServerManager interface {
+	// ManageServer applies the ServerManage request sent by the given connection.
+	// Returning an error replies the failure to the client.
+	ManageServer(c *Conn, p *protocol.ServerManage) error
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+)
+
+// HandlerFunc is an adapter to use an ordinary function as Handler.
+type HandlerFunc func(w *protocol.Wrapper) error
+
+func (f HandlerFunc) Handle(w *protocol.Wrapper) error {
+	return f(w)
+}
+
+// Middleware wraps the Handler of a connection, such as for logging, metrics or rate limits.
+// It returns a Handler that usually calls next.
+type Middleware func(c *Conn, next Handler) Handler
+
+// Chain wraps the handler with the middlewares for the given connection.
+// The first middleware is the outermost, so it sees the packet first.
+func Chain(c *Conn, h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](c, h)
+	}
+	return h
+}
+
+// Recover is a Middleware that recovers a panic in the handler, logs it with the connection name,
+// and disconnects only the client that caused it.
+func Recover(c *Conn, next Handler) Handler {
+	return HandlerFunc(func(w *protocol.Wrapper) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				c.log().Error("handler panicked", "panic", r, "packetID", w.P.ID(), "stack", string(debug.Stack()))
+				err = fmt.Errorf("handler panicked: %v", r)
+				c.DisconnectAndClose("Internal server error")
+			}
+		}()
+		return next.Handle(w)
+	})
+}
+
+// Use adds the middlewares around the Handler of this connection, after the ones of ListenConfig.Middlewares.
+// The first middleware is the outermost.
+func (c *Conn) Use(mw ...Middleware) {
+	c.mu.Lock()
+	c.middlewares = append(c.middlewares, mw...)
+	c.buildChain()
+	c.mu.Unlock()
+}
+
+// buildChain rebuilds the handler chain from the handler and middlewares. c.mu must be held.
+func (c *Conn) buildChain() {
+	var mw []Middleware
+	if c.listener != nil {
+		mw = append(mw, c.listener.middlewares...)
+	}
+	mw = append(mw, c.middlewares...)
+	if c.h == nil && len(mw) == 0 {
+		c.chain = nil
+		return
+	}
+	h := c.h
+	if h == nil {
+		h = DefaultHandler{}
+	}
+	c.chain = Chain(c, h, mw...)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+)
+
+var (
+	// ErrDuplicateName is returned when a client authenticates with a name already in use
+	// and the listener uses DuplicateReject.
+	ErrDuplicateName = errors.New("client name already in use")
+	// ErrInvalidClientName is returned when a client sends a name rejected by validClientName.
+	ErrInvalidClientName = errors.New("invalid client name")
+)
+
+// MaxClientNameLength is the max length in bytes of the name a client sends in its handshake.
+const MaxClientNameLength = 128
+
+// validClientName reports whether the name can be used to identify a client: it must be non-empty valid UTF-8
+// of at most MaxClientNameLength bytes, without control characters.
+func validClientName(name string) bool {
+	if name == "" || len(name) > MaxClientNameLength || !utf8.ValidString(name) {
+		return false
+	}
+	return strings.IndexFunc(name, unicode.IsControl) == -1
+}
+
+// DuplicateNamePolicy decides what happens when a client authenticates with a name already in use.
+type DuplicateNamePolicy int
+
+const (
+	// DuplicateReject denies the new client. This is the default.
+	DuplicateReject DuplicateNamePolicy = iota
+	// DuplicateKickOld disconnects the existing client in favour of the new one.
+	DuplicateKickOld
+	// DuplicateSuffix accepts the new client with the lowest numeric suffix not in use appended to its name,
+	// such as "lobby-1#2". The client is not told about the new name, and the suffix is freed when it disconnects.
+	DuplicateSuffix
+)
+
+// claimName assigns the name to the connection, applying the DuplicateNamePolicy of the listener
+// if it is already in use. A client returning from Conn.Reconnect always takes over its old name.
+// A connection kicked for the name loses it right away, and is disconnected without waiting for its client.
+// It reports whether the client is returning from a reconnect.
+// It returns ErrConnClosed if the connection was closed, as removeConnection would not release the name anymore.
+func (l *Listener) claimName(c *Conn, name string) (bool, error) {
+	var kick *Conn
+
+	l.mu.Lock()
+	select {
+	case <-c.closed:
+		l.mu.Unlock()
+		return false, ErrConnClosed
+	default:
+	}
+	deadline, reconnected := l.reconnecting[name]
+	if reconnected {
+		delete(l.reconnecting, name)
+		reconnected = l.clock.Now().Before(deadline)
+	}
+	if old, ok := l.names[name]; ok && old != c {
+		switch {
+		case reconnected, l.duplicateNames == DuplicateKickOld:
+			kick = old
+		case l.duplicateNames == DuplicateSuffix:
+			base := name
+			for i := 2; ok; i++ {
+				name = base + "#" + strconv.Itoa(i)
+				_, ok = l.names[name]
+			}
+		default:
+			l.mu.Unlock()
+			return false, ErrDuplicateName
+		}
+	}
+	c.Name = name
+	l.names[name] = c
+	l.mu.Unlock()
+
+	if kick != nil {
+		kick.kick("Logged in from another location")
+	}
+	return reconnected, nil
+}
+
+// kick marks the connection as closing and disconnects it with the reason in the background, so that a client
+// that stopped reading does not block the caller for up to the write timeout.
+func (c *Conn) kick(reason string) {
+	if !c.closing.CompareAndSwap(false, true) {
+		return
+	}
+	c.log().Info("disconnecting", "reason", reason)
+	go c.flushAndClose(&protocol.Disconnect{
+		Reason: reason,
+	}, DisconnectInfo{Cause: DisconnectServer, Reason: reason})
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+)
+
+// RequestTimeout is the timeout applied by Request when the context has no deadline.
+const RequestTimeout = 10 * time.Second
+
+// ErrConnClosed is returned when the connection is closed while waiting for a response.
+var ErrConnClosed = errors.New("connection closed")
+
+// Future is a response of the request sent by SendRequest that may not have arrived yet.
+type Future struct {
+	c  *Conn
+	id uint32
+	ch chan *protocol.Wrapper
+}
+
+// pendingResponse is a request waiting for the response with its response ID.
+type pendingResponse struct {
+	// response is the ID of the packet expected in response.
+	response uint64
+	ch       chan *protocol.Wrapper
+}
+
+// ResponseID returns the response ID assigned to the request.
+func (f *Future) ResponseID() uint {
+	return uint(f.id)
+}
+
+// Wait waits for the response until the context is done or the connection is closed.
+// The future is cancelled when Wait returns without a response.
+func (f *Future) Wait(ctx context.Context) (*protocol.Wrapper, error) {
+	select {
+	case w := <-f.ch:
+		return w, nil
+	case <-f.c.closed:
+		f.Cancel()
+		return nil, ErrConnClosed
+	case <-ctx.Done():
+		f.Cancel()
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel stops waiting for the response. A response arriving afterwards is passed to the Handler.
+func (f *Future) Cancel() {
+	f.c.responseMu.Lock()
+	delete(f.c.pendingResponses, f.id)
+	f.c.responseMu.Unlock()
+}
+
+// SendRequest sends the packet with a new response ID and returns the Future of its response,
+// which is the packet of type PT sent back with the same response ID:
+//
+//	f := server.SendRequest[protocol.PlayerPingResponse](c, &protocol.PlayerPingRequest{PlayerName: "Steve"})
+//
+// Any other packet carrying the response ID, such as a request of the client that happens to use the same ID,
+// is passed to the Handler. The request is written immediately along with the packets queued before it,
+// rather than on the next tick, so that it is not held back by a Handler waiting for the response.
+// These packets bypass the budget set by Conn.SetTickBudget. Packets queued after the request wait for the next tick.
+func SendRequest[P any, PT interface {
+	*P
+	protocol.Packet
+}](c *Conn, p protocol.Packet) *Future {
+	return c.sendRequest(p, PT(new(P)).ID())
+}
+
+// Request sends the packet and waits for the response of type PT, as described in SendRequest.
+// RequestTimeout is applied if the context has no deadline.
+// Responses are matched as they are read, so it may be called from Handler.Handle.
+func Request[P any, PT interface {
+	*P
+	protocol.Packet
+}](ctx context.Context, c *Conn, p protocol.Packet) (PT, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, RequestTimeout)
+		defer cancel()
+	}
+	w, err := SendRequest[P, PT](c, p).Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A custom Registry may decode the ID of PT to another packet.
+	resp, ok := w.P.(PT)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response packet: %T", w.P)
+	}
+	return resp, nil
+}
+
+// PlayerPing sends a PlayerPingRequest for the given player and waits for the matching PlayerPingResponse.
+func (c *Conn) PlayerPing(ctx context.Context, playerName string) (*protocol.PlayerPingResponse, error) {
+	return Request[protocol.PlayerPingResponse](ctx, c, &protocol.PlayerPingRequest{PlayerName: playerName})
+}
+
+// sendRequest sends the packet with a new response ID, expecting the response with the given packet ID.
+func (c *Conn) sendRequest(p protocol.Packet, response uint64) *Future {
+	f := &Future{c: c, ch: make(chan *protocol.Wrapper, 1)}
+
+	c.responseMu.Lock()
+	c.lastResponseID++
+	if c.lastResponseID == 0 {
+		c.lastResponseID = 1
+	}
+	f.id = c.lastResponseID
+	c.pendingResponses[f.id] = pendingResponse{response: response, ch: f.ch}
+	c.responseMu.Unlock()
+
+	w := &protocol.Wrapper{
+		P:          p,
+		Response:   true,
+		ResponseID: uint(f.id),
+	}
+	c.QueuePacket(w)
+	if err := c.flushThrough(w); err != nil {
+		c.log().Error("failed to write packet", "err", err)
+		c.closeConn(DisconnectInfo{Cause: DisconnectWriteError, Err: err})
+	}
+	return f
+}
+
+// resolveResponse delivers the wrapper to the pending request with the same response ID,
+// if it carries the packet expected by the request. It returns false if no request is waiting for it.
+func (c *Conn) resolveResponse(w *protocol.Wrapper) bool {
+	// Response IDs are 32-bit on the wire.
+	id := uint32(w.ResponseID)
+	c.responseMu.Lock()
+	pending, ok := c.pendingResponses[id]
+	ok = ok && pending.response == w.P.ID()
+	if ok {
+		delete(c.pendingResponses, id)
+	}
+	c.responseMu.Unlock()
+
+	if ok {
+		pending.ch <- w
+	}
+	return ok
+}
+
+// clearResponses drops all pending requests. Their futures return ErrConnClosed.
+func (c *Conn) clearResponses() {
+	c.responseMu.Lock()
+	clear(c.pendingResponses)
+	c.responseMu.Unlock()
+}
@@ -0,0 +1,55 @@
+package server
+
+import "github.com/alvin0319/go-stargate-server/protocol"
+
+// Router is a Handler that dispatches packets to the functions registered per packet type with Route.
+// Routes must be registered before the Router is used. The Router may be shared by multiple connections.
+// The zero value is a Router with no routes.
+type Router struct {
+	routes   map[uint64]func(w *protocol.Wrapper) (bool, error)
+	fallback func(w *protocol.Wrapper) error
+}
+
+// NewRouter returns a new Router with no routes.
+func NewRouter() *Router {
+	return &Router{routes: make(map[uint64]func(w *protocol.Wrapper) (bool, error))}
+}
+
+// Route registers f to handle the packets of type PT, replacing the function registered for the same packet ID.
+// The packet type is inferred from f:
+//
+//	server.Route(r, func(w *protocol.Wrapper, pk *protocol.ServerTransfer) error {
+//		...
+//	})
+func Route[P any, PT interface {
+	*P
+	protocol.Packet
+}](r *Router, f func(w *protocol.Wrapper, pk PT) error) {
+	if r.routes == nil {
+		r.routes = make(map[uint64]func(w *protocol.Wrapper) (bool, error))
+	}
+	r.routes[PT(new(P)).ID()] = func(w *protocol.Wrapper) (bool, error) {
+		pk, ok := w.P.(PT)
+		if !ok {
+			return false, nil
+		}
+		return true, f(w, pk)
+	}
+}
+
+// Fallback sets the function that handles the packets with no route, including Unknown packets.
+func (r *Router) Fallback(f func(w *protocol.Wrapper) error) {
+	r.fallback = f
+}
+
+func (r *Router) Handle(w *protocol.Wrapper) error {
+	if route, ok := r.routes[w.P.ID()]; ok {
+		if handled, err := route(w); handled {
+			return err
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback(w)
+	}
+	return nil
+}
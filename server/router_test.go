@@ -0,0 +1,46 @@
+package server_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/server"
+)
+
+// fakeTransfer is a custom packet using the ID of protocol.ServerTransfer.
+type fakeTransfer struct{}
+
+func (*fakeTransfer) Read(io.Reader) error  { return nil }
+func (*fakeTransfer) Write(io.Writer) error { return nil }
+func (*fakeTransfer) ID() uint64            { return protocol.IDServerTransfer }
+
+func TestRouter(t *testing.T) {
+	var routed, fallback []protocol.Packet
+	var r server.Router
+	server.Route(&r, func(w *protocol.Wrapper, pk *protocol.ServerTransfer) error {
+		routed = append(routed, pk)
+		return nil
+	})
+	r.Fallback(func(w *protocol.Wrapper) error {
+		fallback = append(fallback, w.P)
+		return nil
+	})
+
+	transfer := &protocol.ServerTransfer{PlayerName: "Steve", TargetServer: "game"}
+	fake := &fakeTransfer{}
+	unknown := &protocol.Unknown{PacketID: 0x64}
+	ping := &protocol.Ping{PingTime: 1}
+	for _, p := range []protocol.Packet{transfer, fake, unknown, ping} {
+		if err := r.Handle(&protocol.Wrapper{P: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(routed) != 1 || routed[0] != transfer {
+		t.Errorf("routed %v, want only the ServerTransfer", routed)
+	}
+	if len(fallback) != 3 || fallback[0] != fake || fallback[1] != unknown || fallback[2] != ping {
+		t.Errorf("fallback got %v, want the packet of another type, the Unknown and the Ping", fallback)
+	}
+}
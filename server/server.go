@@ -1,19 +1,42 @@
 package server
 
 import (
+	"crypto/tls"
 	"net"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
 )
 
 type Listener struct {
 	incoming chan *Conn
 	close    chan struct{}
-	password string
+
+	authenticator    Authenticator
+	requireChallenge bool
+	duplicateNames   DuplicateNamePolicy
+	lifecycle        LifecycleHandler
+	middlewares      []Middleware
+	registry         *protocol.Registry
+	clock            Clock
+	writeTimeout     time.Duration
 
 	mu          sync.RWMutex
 	connections map[*Conn]struct{}
+	// names maps client names to the connections that claimed them.
+	names map[string]*Conn
 
 	listener net.Listener
+
+	// reconnecting contains the names of clients asked to reconnect, mapped to the deadline to return.
+	reconnecting map[string]time.Time
+
+	infoProvider  InfoProvider
+	serverManager ServerManager
 }
 
 // Accept accepts *Conn from the Listener.
@@ -37,7 +60,7 @@ func (l *Listener) Close() {
 
 	// Disconnect all clients with proper message
 	for _, conn := range conns {
-		conn.DisconnectAndClose("StarGate server shutdown")
+		conn.disconnect("StarGate server shutdown", DisconnectShutdown)
 	}
 
 	// Signal shutdown
@@ -55,23 +78,195 @@ func (l *Listener) addConnection(c *Conn) {
 func (l *Listener) removeConnection(c *Conn) {
 	l.mu.Lock()
 	delete(l.connections, c)
+	if l.names[c.Name] == c {
+		delete(l.names, c.Name)
+	}
+	l.mu.Unlock()
+}
+
+// Addr returns the address the listener accepts connections on.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Registry returns the set of packets decoded by the connections of the listener.
+// Custom packets may be registered to it at any time.
+func (l *Listener) Registry() *protocol.Registry {
+	return l.registry
+}
+
+// authenticate authenticates the client of given connection with the handshake data it sent.
+func (l *Listener) authenticate(c *Conn, data *types.HandshakeData) error {
+	if l.authenticator == nil {
+		return ErrUnknownClient
+	}
+	return l.authenticator.Authenticate(c, data)
+}
+
+// secret returns the secret the client of given connection has to prove by challenge-response.
+func (l *Listener) secret(c *Conn, data *types.HandshakeData) (string, error) {
+	a, ok := l.authenticator.(ChallengeAuthenticator)
+	if !ok {
+		return "", ErrChallengeUnsupported
+	}
+	return a.Secret(c, data)
+}
+
+// InfoProvider sets the provider used to answer ServerInfoRequest packets.
+// A nil provider restores DefaultInfoProvider.
+func (l *Listener) InfoProvider(p InfoProvider) {
+	l.mu.Lock()
+	l.infoProvider = p
+	l.mu.Unlock()
+}
+
+// serverInfo returns the server information requested by the given connection.
+func (l *Listener) serverInfo(c *Conn, req *protocol.ServerInfoRequest) (*protocol.ServerInfoResponse, error) {
+	l.mu.RLock()
+	p := l.infoProvider
+	l.mu.RUnlock()
+	if p == nil {
+		p = DefaultInfoProvider{l: l}
+	}
+	return p.ServerInfo(c, req)
+}
+
+// ServerManager sets the manager used to apply ServerManage packets.
+func (l *Listener) ServerManager(m ServerManager) {
+	l.mu.Lock()
+	l.serverManager = m
+	l.mu.Unlock()
+}
+
+// manageServer applies the ServerManage packet sent by the given connection.
+func (l *Listener) manageServer(c *Conn, p *protocol.ServerManage) error {
+	l.mu.RLock()
+	m := l.serverManager
+	l.mu.RUnlock()
+	if m == nil {
+		return errNoServerManager
+	}
+	return m.ManageServer(c, p)
+}
+
+// expectReconnect marks the client with the given name as reconnecting.
+// Clients that did not return before their deadline are forgotten, so that the map does not grow forever.
+func (l *Listener) expectReconnect(name string) {
+	now := l.clock.Now()
+	l.mu.Lock()
+	for n, deadline := range l.reconnecting {
+		if !now.Before(deadline) {
+			delete(l.reconnecting, n)
+		}
+	}
+	l.reconnecting[name] = now.Add(ReconnectTimeout)
 	l.mu.Unlock()
 }
 
-// Listen binds the TCP server on specified addr.
+// Conn returns the authenticated connection with the given client name.
+func (l *Listener) Conn(name string) (*Conn, bool) {
+	l.mu.RLock()
+	conn, ok := l.names[name]
+	l.mu.RUnlock()
+	if !ok || conn.State() != StateConnected {
+		return nil, false
+	}
+	return conn, true
+}
+
+// AuthenticatedConnections returns a copied slice of authenticated connections, sorted by name.
+func (l *Listener) AuthenticatedConnections() []*Conn {
+	l.mu.RLock()
+	conns := make([]*Conn, 0, len(l.names))
+	for _, conn := range l.names {
+		if conn.State() == StateConnected {
+			conns = append(conns, conn)
+		}
+	}
+	l.mu.RUnlock()
+	slices.SortFunc(conns, func(a, b *Conn) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return conns
+}
+
+// ListenConfig holds the settings used to create a Listener.
+type ListenConfig struct {
+	// Authenticator authenticates the clients connecting to the Listener.
+	// If nil, every client is denied.
+	Authenticator Authenticator
+	// TLSConfig, if not nil, wraps the Listener in TLS.
+	// Set ClientAuth to tls.RequireAndVerifyClientCert and ClientCAs to verify client certificates,
+	// and use CertificateAuthenticator to match them with client names.
+	TLSConfig *tls.Config
+	// RequireChallenge denies clients sending their password in the handshake.
+	// Clients must then authenticate by challenge-response, which requires Authenticator to implement ChallengeAuthenticator.
+	RequireChallenge bool
+	// DuplicateNames decides what happens when a client authenticates with a name already in use.
+	DuplicateNames DuplicateNamePolicy
+	// Lifecycle, if not nil, is notified of the lifecycle events of every connection.
+	Lifecycle LifecycleHandler
+	// Middlewares wrap the Handler of every connection, outside the ones added by Conn.Use.
+	Middlewares []Middleware
+	// Registry is the set of packets decoded by the connections of the listener.
+	// If nil, protocol.DefaultRegistry is used.
+	Registry *protocol.Registry
+	// Clock is the source of the current time of the listener and its connections.
+	// If nil, the system clock is used.
+	Clock Clock
+	// WriteTimeout is the max duration of a write to a client, after which the connection is closed,
+	// so that a client that stopped reading cannot block the server. If zero, DefaultWriteTimeout is used.
+	WriteTimeout time.Duration
+}
+
+// Listen binds the TCP server on specified addr with the password shared by all clients.
 func Listen(addr, password string) (*Listener, error) {
+	return ListenConfig{Authenticator: PasswordAuthenticator{Password: password}}.Listen(addr)
+}
+
+// Listen binds the TCP server on specified addr using the ListenConfig.
+func (conf ListenConfig) Listen(addr string) (*Listener, error) {
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	return conf.Serve(l)
+}
+
+// Serve serves StarGate clients accepted from the net.Listener using the ListenConfig.
+// The net.Listener is closed when the Listener is closed.
+func (conf ListenConfig) Serve(l net.Listener) (*Listener, error) {
+	if conf.TLSConfig != nil {
+		l = tls.NewListener(l, conf.TLSConfig)
+	}
 
 	listener := &Listener{
-		incoming:    make(chan *Conn),
-		close:       make(chan struct{}),
-		password:    password,
-		connections: make(map[*Conn]struct{}),
-		listener:    l,
+		incoming:         make(chan *Conn),
+		close:            make(chan struct{}),
+		authenticator:    conf.Authenticator,
+		requireChallenge: conf.RequireChallenge,
+		duplicateNames:   conf.DuplicateNames,
+		lifecycle:        conf.Lifecycle,
+		middlewares:      conf.Middlewares,
+		registry:         conf.Registry,
+		clock:            conf.Clock,
+		writeTimeout:     conf.WriteTimeout,
+		connections:      make(map[*Conn]struct{}),
+		names:            make(map[string]*Conn),
+		listener:         l,
+
+		reconnecting: make(map[string]time.Time),
+	}
+	if listener.registry == nil {
+		listener.registry = protocol.DefaultRegistry()
+	}
+	if listener.clock == nil {
+		listener.clock = realClock{}
+	}
+	if listener.writeTimeout == 0 {
+		listener.writeTimeout = DefaultWriteTimeout
 	}
+	listener.infoProvider = DefaultInfoProvider{l: listener}
 	go func() {
 		for {
 			conn, err := l.Accept()
@@ -83,7 +278,7 @@ func Listen(addr, password string) (*Listener, error) {
 					continue
 				}
 			}
-			c := newConn(conn, listener.password, listener)
+			c := newConn(conn, listener)
 			listener.addConnection(c)
 			go c.tick()
 			listener.incoming <- c
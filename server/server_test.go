@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+)
+
+// fixedClock is a Clock that returns the time it is set to.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestExpectReconnectPrunesExpired(t *testing.T) {
+	clock := &fixedClock{now: time.Unix(0, 0)}
+	l := &Listener{clock: clock, reconnecting: make(map[string]time.Time)}
+
+	l.expectReconnect("lobby")
+	l.expectReconnect("game")
+	clock.now = clock.now.Add(ReconnectTimeout)
+	l.expectReconnect("hub")
+
+	if len(l.reconnecting) != 1 {
+		t.Fatalf("got %d reconnecting clients, want 1: %v", len(l.reconnecting), l.reconnecting)
+	}
+	if deadline := l.reconnecting["hub"]; !deadline.Equal(clock.now.Add(ReconnectTimeout)) {
+		t.Errorf("got deadline %v, want %v", deadline, clock.now.Add(ReconnectTimeout))
+	}
+}
+
+func TestResponseIDWraps(t *testing.T) {
+	client, srv := net.Pipe()
+	defer client.Close()
+	c := &Conn{Conn: srv, closed: make(chan struct{}), lastResponseID: math.MaxUint32, pendingResponses: make(map[uint32]pendingResponse)}
+	c.logger.Store(slog.Default())
+
+	sent := make(chan *protocol.Wrapper, 1)
+	go func() {
+		w, err := protocol.NewDecoder(client, protocol.DefaultRegistry()).Decode()
+		if err != nil {
+			t.Error(err)
+		}
+		sent <- w
+	}()
+	f := SendRequest[protocol.PlayerPingResponse](c, &protocol.PlayerPingRequest{PlayerName: "Steve"})
+	if f.ResponseID() != 1 {
+		t.Fatalf("got response ID %d after wrapping, want 1", f.ResponseID())
+	}
+	if w := <-sent; w == nil || w.ResponseID != 1 {
+		t.Errorf("got %+v on the wire, want response ID 1", w)
+	}
+
+	if !c.resolveResponse(&protocol.Wrapper{P: &protocol.PlayerPingResponse{}, Response: true, ResponseID: 1}) {
+		t.Error("response was not resolved")
+	}
+}
+
+func TestClaimNameAfterClose(t *testing.T) {
+	l := &Listener{clock: &fixedClock{}, names: make(map[string]*Conn), reconnecting: make(map[string]time.Time)}
+	c := &Conn{closed: make(chan struct{})}
+	close(c.closed)
+
+	if _, err := l.claimName(c, "lobby"); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("got error %v, want ErrConnClosed", err)
+	}
+	if _, ok := l.names["lobby"]; ok {
+		t.Error("name claimed by a closed connection")
+	}
+}
@@ -0,0 +1,182 @@
+package servertest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/protocol"
+	"github.com/alvin0319/go-stargate-server/protocol/types"
+)
+
+// DefaultTimeout is the timeout used by Client.Handshake and Expect.
+var DefaultTimeout = 2 * time.Second
+
+// ErrTimeout is returned when no packet was received in time.
+var ErrTimeout = errors.New("timed out waiting for packet")
+
+// Client is a scripted StarGate client. Unlike client.Conn, it does nothing on its own: it neither answers
+// pings nor sends them, and every packet it receives is kept for Next and Expect in the order received.
+// Packets may be sent concurrently, but Next, Expect, Sync and Closed must be called from one goroutine.
+type Client struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+	enc     *protocol.Encoder
+
+	packets chan *protocol.Wrapper
+	// err is the error that stopped reading, set before packets is closed.
+	err error
+
+	// pending contains the packets received during Sync, returned by Next before packets.
+	pending []*protocol.Wrapper
+	syncID  int64
+}
+
+// NewClient returns a Client reading and writing packets on the connection, which is usually the client
+// side of a connection to the server. Packets are decoded with the registry, or protocol.DefaultRegistry if nil.
+func NewClient(conn net.Conn, reg *protocol.Registry) *Client {
+	c := &Client{
+		conn:    conn,
+		enc:     protocol.NewEncoder(conn),
+		packets: make(chan *protocol.Wrapper, 1024),
+	}
+	go c.read(protocol.NewDecoder(conn, reg))
+	return c
+}
+
+// read decodes packets until the connection fails. It must keep reading, as writes to a net.Pipe
+// block until they are read.
+func (c *Client) read(dec *protocol.Decoder) {
+	defer close(c.packets)
+	for {
+		w, err := dec.Decode()
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.packets <- w
+	}
+}
+
+// Send writes the packet to the server immediately.
+func (c *Client) Send(p protocol.Packet) error {
+	return c.SendWrapper(&protocol.Wrapper{P: p})
+}
+
+// SendWrapper writes the wrapper to the server immediately.
+func (c *Client) SendWrapper(w *protocol.Wrapper) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.enc.Encode(w)
+}
+
+// SendRaw writes the bytes to the server as-is, such as a malformed frame.
+func (c *Client) SendRaw(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// Handshake sends the Handshake with the data and waits for a successful ServerHandshake.
+func (c *Client) Handshake(data types.HandshakeData) error {
+	if err := c.Send(&protocol.Handshake{Data: data}); err != nil {
+		return err
+	}
+	hs, err := Expect[protocol.ServerHandshake](c, DefaultTimeout)
+	if err != nil {
+		return err
+	}
+	if !hs.Success {
+		return fmt.Errorf("handshake denied by server")
+	}
+	return nil
+}
+
+// Sync waits until the server has handled every packet sent before, by sending a Ping and waiting for its Pong.
+// Packets received in the meantime are kept for Next.
+func (c *Client) Sync(timeout time.Duration) error {
+	c.syncID--
+	id := c.syncID
+	if err := c.Send(&protocol.Ping{PingTime: id}); err != nil {
+		return err
+	}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case w, ok := <-c.packets:
+			if !ok {
+				return c.err
+			}
+			if pong, ok := w.P.(*protocol.Pong); ok && pong.PingTime == id {
+				return nil
+			}
+			c.pending = append(c.pending, w)
+		case <-deadline:
+			return ErrTimeout
+		}
+	}
+}
+
+// Next waits for the next packet received from the server.
+// It returns the read error once the connection is closed and all packets received were returned.
+func (c *Client) Next(timeout time.Duration) (*protocol.Wrapper, error) {
+	if len(c.pending) > 0 {
+		w := c.pending[0]
+		c.pending = c.pending[1:]
+		return w, nil
+	}
+	select {
+	case w, ok := <-c.packets:
+		if !ok {
+			return nil, c.err
+		}
+		return w, nil
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	}
+}
+
+// Expect waits for the next packet received from the server and returns it if it is a P.
+// Any other packet is returned in the error.
+func Expect[P any, PT interface {
+	*P
+	protocol.Packet
+}](c *Client, timeout time.Duration) (PT, error) {
+	w, err := c.Next(timeout)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := w.P.(PT)
+	if !ok {
+		return nil, fmt.Errorf("expected %T, got %T %+v", PT(nil), w.P, w.P)
+	}
+	return pk, nil
+}
+
+// Closed waits for the server to close the connection, returning the packets received before.
+// It returns ErrTimeout if the connection is still open after the timeout.
+func (c *Client) Closed(timeout time.Duration) ([]*protocol.Wrapper, error) {
+	received := c.pending
+	c.pending = nil
+	deadline := time.After(timeout)
+	for {
+		select {
+		case w, ok := <-c.packets:
+			if !ok {
+				return received, nil
+			}
+			received = append(received, w)
+		case <-deadline:
+			return received, ErrTimeout
+		}
+	}
+}
+
+// Close closes the connection without sending a Disconnect.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
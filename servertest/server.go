@@ -0,0 +1,58 @@
+// Package servertest provides helpers to test code built on the server package end to end, without
+// opening sockets or waiting on real timers:
+//
+//	srv := servertest.NewServer(server.ListenConfig{
+//		Authenticator: server.PasswordAuthenticator{Password: "secret"},
+//	})
+//	defer srv.Close()
+//
+//	c, _ := srv.Dial()
+//	_ = c.Handshake(types.HandshakeData{ClientName: "lobby", Password: "secret"})
+//	conn := srv.Accept()
+//	conn.Handler(myHandler)
+//
+//	srv.Clock.Advance(server.PingInterval)
+//	ping, _ := servertest.Expect[protocol.Ping](c, servertest.DefaultTimeout)
+package servertest
+
+import (
+	"time"
+
+	"github.com/alvin0319/go-stargate-server/server"
+)
+
+// Server is a server.Listener serving connections created in memory, with a Clock advanced by the test.
+type Server struct {
+	*server.Listener
+
+	// Clock is the clock of the listener. It is nil if ListenConfig.Clock was set to a clock of another type.
+	Clock *Clock
+
+	pipe *PipeListener
+}
+
+// NewServer returns a Server created with the config, serving connections created by Dial.
+// If conf.Clock is nil, a new Clock is used. It panics if the listener cannot be created.
+func NewServer(conf server.ListenConfig) *Server {
+	if conf.Clock == nil {
+		conf.Clock = NewClock(time.Unix(0, 0))
+	}
+	clock, _ := conf.Clock.(*Clock)
+
+	pipe := NewPipeListener()
+	l, err := conf.Serve(pipe)
+	if err != nil {
+		panic("servertest: failed to serve: " + err.Error())
+	}
+	return &Server{Listener: l, Clock: clock, pipe: pipe}
+}
+
+// Dial connects a new Client to the server, decoding packets with the registry of the listener.
+// The *server.Conn of the client is returned by Accept, which must be called for every Dial.
+func (s *Server) Dial() (*Client, error) {
+	conn, err := s.pipe.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, s.Registry()), nil
+}
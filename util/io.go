@@ -19,9 +19,10 @@ func WriteString(w io.Writer, s string) error {
 
 // ReadString reads a string with a 4-byte big-endian length prefix.
 // This matches the Java ByteBuf string encoding used in StarGate.
+// A *LengthError is returned if the length is negative, over the MaxStringLength of LimitsOf(r) or over the remaining bytes.
 func ReadString(r io.Reader) (string, error) {
-	var length int32
-	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+	length, err := readLength(r, LimitsOf(r).MaxStringLength, 1)
+	if err != nil {
 		return "", err
 	}
 	data := make([]byte, length)
@@ -174,8 +175,9 @@ func WriteBytes(w io.Writer, data []byte) error {
 }
 
 // ReadBytes reads a byte array with a 4-byte big-endian length prefix.
+// A *LengthError is returned if the length is negative, over the MaxStringLength of LimitsOf(r) or over the remaining bytes.
 func ReadBytes(r io.Reader) ([]byte, error) {
-	length, err := ReadInt32(r)
+	length, err := readLength(r, LimitsOf(r).MaxStringLength, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -200,13 +202,14 @@ func WriteStringArray(w io.Writer, arr []string) error {
 }
 
 // ReadStringArray reads a string array with a 4-byte length prefix followed by each string.
+// A *LengthError is returned if the length is negative, over the MaxArrayLength of LimitsOf(r) or over the remaining bytes.
 func ReadStringArray(r io.Reader) ([]string, error) {
-	length, err := ReadInt32(r)
+	length, err := readLength(r, LimitsOf(r).MaxArrayLength, 4)
 	if err != nil {
 		return nil, err
 	}
 	arr := make([]string, length)
-	for i := int32(0); i < length; i++ {
+	for i := 0; i < length; i++ {
 		s, err := ReadString(r)
 		if err != nil {
 			return nil, err
@@ -230,13 +233,14 @@ func WriteInt32Array(w io.Writer, arr []int32) error {
 }
 
 // ReadInt32Array reads an int32 array with a 4-byte length prefix.
+// A *LengthError is returned if the length is negative, over the MaxArrayLength of LimitsOf(r) or over the remaining bytes.
 func ReadInt32Array(r io.Reader) ([]int32, error) {
-	length, err := ReadInt32(r)
+	length, err := readLength(r, LimitsOf(r).MaxArrayLength, 4)
 	if err != nil {
 		return nil, err
 	}
 	arr := make([]int32, length)
-	for i := int32(0); i < length; i++ {
+	for i := 0; i < length; i++ {
 		v, err := ReadInt32(r)
 		if err != nil {
 			return nil, err
@@ -260,13 +264,14 @@ func WriteInt64Array(w io.Writer, arr []int64) error {
 }
 
 // ReadInt64Array reads an int64 array with a 4-byte length prefix.
+// A *LengthError is returned if the length is negative, over the MaxArrayLength of LimitsOf(r) or over the remaining bytes.
 func ReadInt64Array(r io.Reader) ([]int64, error) {
-	length, err := ReadInt32(r)
+	length, err := readLength(r, LimitsOf(r).MaxArrayLength, 8)
 	if err != nil {
 		return nil, err
 	}
 	arr := make([]int64, length)
-	for i := int32(0); i < length; i++ {
+	for i := 0; i < length; i++ {
 		v, err := ReadInt64(r)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// lengthReaders are the readers of length-prefixed values, with the limit they are checked against
+// and the minimum size of an element.
+var lengthReaders = []struct {
+	name     string
+	read     func(io.Reader) error
+	limit    func(Limits) int
+	elemSize int
+}{
+	{"ReadString", func(r io.Reader) error { _, err := ReadString(r); return err }, func(l Limits) int { return l.MaxStringLength }, 1},
+	{"ReadBytes", func(r io.Reader) error { _, err := ReadBytes(r); return err }, func(l Limits) int { return l.MaxStringLength }, 1},
+	{"ReadStringArray", func(r io.Reader) error { _, err := ReadStringArray(r); return err }, func(l Limits) int { return l.MaxArrayLength }, 4},
+	{"ReadInt32Array", func(r io.Reader) error { _, err := ReadInt32Array(r); return err }, func(l Limits) int { return l.MaxArrayLength }, 4},
+	{"ReadInt64Array", func(r io.Reader) error { _, err := ReadInt64Array(r); return err }, func(l Limits) int { return l.MaxArrayLength }, 8},
+}
+
+// prefixed returns the length prefix followed by n zero bytes.
+func prefixed(length int32, n int) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(length))
+	return append(b, make([]byte, n)...)
+}
+
+func TestReadLengthErrors(t *testing.T) {
+	defaults := Limits{}.withDefaults()
+	for _, rd := range lengthReaders {
+		t.Run(rd.name, func(t *testing.T) {
+			tests := []struct {
+				name string
+				r    io.Reader
+				want error
+			}{
+				{"negative", bytes.NewReader(prefixed(-1, 16)), ErrNegativeLength},
+				{"over max", bytes.NewReader(prefixed(int32(rd.limit(defaults))+1, 16)), ErrLengthExceedsMax},
+				{"over custom max", NewReader(bytes.NewReader(prefixed(3, 64)), Limits{MaxStringLength: 2, MaxArrayLength: 2}), ErrLengthExceedsMax},
+				{"over remaining", bytes.NewReader(prefixed(2, 2*rd.elemSize-1)), ErrLengthExceedsRemaining},
+				{"over remaining of Reader", NewReader(bytes.NewReader(prefixed(2, 2*rd.elemSize-1)), Limits{}), ErrLengthExceedsRemaining},
+			}
+			for _, tt := range tests {
+				err := rd.read(tt.r)
+				var lengthErr *LengthError
+				if !errors.Is(err, tt.want) || !errors.As(err, &lengthErr) {
+					t.Errorf("%s: got %v, want LengthError matching %v", tt.name, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLengthUnknownRemaining(t *testing.T) {
+	for _, rd := range lengthReaders {
+		// The remaining bytes of a plain io.Reader are unknown, so the read fails at the end of data instead.
+		data := prefixed(2, 2*rd.elemSize-1)
+		for _, r := range []io.Reader{
+			io.MultiReader(bytes.NewReader(data)),
+			NewReader(io.MultiReader(bytes.NewReader(data)), Limits{}),
+		} {
+			if err := rd.read(r); !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+				t.Errorf("%s from %T: got %v, want EOF", rd.name, r, err)
+			}
+		}
+	}
+}
+
+func TestReadLengthWithinLimits(t *testing.T) {
+	limits := Limits{MaxStringLength: 2, MaxArrayLength: 2}
+	for _, rd := range lengthReaders {
+		if err := rd.read(NewReader(bytes.NewReader(prefixed(2, 2*rd.elemSize)), limits)); err != nil {
+			t.Errorf("%s: %v", rd.name, err)
+		}
+	}
+}
+
+func TestLimitsOf(t *testing.T) {
+	if got, want := LimitsOf(bytes.NewReader(nil)), (Limits{DefaultMaxStringLength, DefaultMaxArrayLength}); got != want {
+		t.Errorf("plain reader: got %+v, want %+v", got, want)
+	}
+	got := LimitsOf(NewReader(nil, Limits{MaxArrayLength: 10}))
+	if want := (Limits{DefaultMaxStringLength, 10}); got != want {
+		t.Errorf("Reader: got %+v, want %+v", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, err := range []error{
+		WriteString(&buf, "Steve"),
+		WriteBytes(&buf, []byte{1, 2}),
+		WriteStringArray(&buf, []string{"a", ""}),
+		WriteInt32Array(&buf, []int32{-1, 1}),
+		WriteInt64Array(&buf, []int64{-1}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bytes.NewReader(buf.Bytes())
+	if s, err := ReadString(r); err != nil || s != "Steve" {
+		t.Errorf("ReadString: got %q, %v", s, err)
+	}
+	if b, err := ReadBytes(r); err != nil || !bytes.Equal(b, []byte{1, 2}) {
+		t.Errorf("ReadBytes: got %v, %v", b, err)
+	}
+	if arr, err := ReadStringArray(r); err != nil || len(arr) != 2 || arr[0] != "a" || arr[1] != "" {
+		t.Errorf("ReadStringArray: got %q, %v", arr, err)
+	}
+	if arr, err := ReadInt32Array(r); err != nil || len(arr) != 2 || arr[0] != -1 || arr[1] != 1 {
+		t.Errorf("ReadInt32Array: got %v, %v", arr, err)
+	}
+	if arr, err := ReadInt64Array(r); err != nil || len(arr) != 1 || arr[0] != -1 {
+		t.Errorf("ReadInt64Array: got %v, %v", arr, err)
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left", r.Len())
+	}
+}
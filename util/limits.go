@@ -0,0 +1,127 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultMaxStringLength is the max length of a string or byte array if Limits does not set one.
+	// It is the max payload length of a frame.
+	DefaultMaxStringLength = 1024 * 1024
+	// DefaultMaxArrayLength is the max count of elements of an array if Limits does not set one.
+	// It is the most 4-byte elements that fit in a frame.
+	DefaultMaxArrayLength = 1024 * 1024 / 4
+)
+
+// Limits are the max lengths accepted by the readers of this package. A zero field uses its default.
+// The readers apply the Limits of a Reader, and the defaults to any other io.Reader.
+type Limits struct {
+	// MaxStringLength is the max length in bytes of a string or byte array read by ReadString and ReadBytes.
+	MaxStringLength int
+	// MaxArrayLength is the max count of elements of an array read by ReadStringArray, ReadInt32Array and
+	// ReadInt64Array.
+	MaxArrayLength int
+}
+
+// withDefaults returns the Limits with zero fields set to their defaults.
+func (l Limits) withDefaults() Limits {
+	if l.MaxStringLength <= 0 {
+		l.MaxStringLength = DefaultMaxStringLength
+	}
+	if l.MaxArrayLength <= 0 {
+		l.MaxArrayLength = DefaultMaxArrayLength
+	}
+	return l
+}
+
+// Reader is an io.Reader carrying the Limits applied by the readers of this package to the lengths read from it.
+// Each Reader has its own Limits, so that connections with different limits can be read concurrently.
+type Reader struct {
+	r      io.Reader
+	limits Limits
+}
+
+// NewReader returns a Reader reading from r with the limits.
+func NewReader(r io.Reader, limits Limits) *Reader {
+	return &Reader{r: r, limits: limits.withDefaults()}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Len returns the bytes remaining in the underlying reader if it reports them with a Len method,
+// like bytes.Reader, or -1 otherwise.
+func (r *Reader) Len() int {
+	if l, ok := r.r.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	return -1
+}
+
+// Limits returns the limits of the Reader, with zero fields set to their defaults.
+func (r *Reader) Limits() Limits {
+	return r.limits
+}
+
+// LimitsOf returns the Limits of r if it is a Reader, or the default limits otherwise.
+func LimitsOf(r io.Reader) Limits {
+	if lr, ok := r.(*Reader); ok {
+		return lr.limits
+	}
+	return Limits{}.withDefaults()
+}
+
+var (
+	// ErrNegativeLength is returned when a length prefix is negative.
+	ErrNegativeLength = errors.New("negative length")
+	// ErrLengthExceedsMax is returned when a length prefix is over the MaxStringLength or MaxArrayLength of Limits.
+	ErrLengthExceedsMax = errors.New("length exceeds max")
+	// ErrLengthExceedsRemaining is returned when a length prefix is over the bytes remaining in the reader.
+	ErrLengthExceedsRemaining = errors.New("length exceeds remaining bytes")
+)
+
+// LengthError is returned when a length prefix read is invalid, before anything is allocated for it.
+// Err is one of ErrNegativeLength, ErrLengthExceedsMax and ErrLengthExceedsRemaining, which errors.Is matches.
+type LengthError struct {
+	// Length is the length prefix read.
+	Length int32
+	// Limit is the max length or the remaining bytes the length was checked against.
+	Limit int
+	Err   error
+}
+
+func (e *LengthError) Error() string {
+	if e.Err == ErrNegativeLength {
+		return fmt.Sprintf("invalid length %d: %v", e.Length, e.Err)
+	}
+	return fmt.Sprintf("invalid length %d: %v (%d)", e.Length, e.Err, e.Limit)
+}
+
+func (e *LengthError) Unwrap() error {
+	return e.Err
+}
+
+// readLength reads an int32 length prefix and checks it against max. If the reader reports the remaining bytes
+// with a Len method, like bytes.Reader, the length is also checked to fit in them with elements of elemSize
+// bytes at least. A negative Len means the remaining bytes are unknown.
+func readLength(r io.Reader, max, elemSize int) (int, error) {
+	length, err := ReadInt32(r)
+	if err != nil {
+		return 0, err
+	}
+	if length < 0 {
+		return 0, &LengthError{Length: length, Err: ErrNegativeLength}
+	}
+	if int(length) > max {
+		return 0, &LengthError{Length: length, Limit: max, Err: ErrLengthExceedsMax}
+	}
+	if l, ok := r.(interface{ Len() int }); ok {
+		if remaining := l.Len(); remaining >= 0 && int(length)*elemSize > remaining {
+			return 0, &LengthError{Length: length, Limit: remaining, Err: ErrLengthExceedsRemaining}
+		}
+	}
+	return int(length), nil
+}